@@ -0,0 +1,286 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/whirl-lang/whirl/pkg/diagnostic"
+	"github.com/whirl-lang/whirl/pkg/pipeline"
+	"github.com/whirl-lang/whirl/pkg/toolchain"
+)
+
+// BuildFlags are the flags of the commands that compile the generated C.
+type BuildFlags struct {
+	// KeepC keeps the generated C code around.
+	KeepC bool
+	// OutDir is where the generated files are written, see NewWorkspace.
+	OutDir string
+	// CC is the C compiler to use, see toolchain.Find.
+	CC      string
+	Options toolchain.Options
+}
+
+func (b *BuildFlags) Register(flags *flag.FlagSet) {
+	flags.BoolVar(&b.KeepC, "keep-c", false, "keep the generated C code and print where it is")
+	flags.BoolVar(&b.KeepC, "c", false, "short for -keep-c")
+	flags.StringVar(&b.OutDir, "out-dir", "", "the `directory` to write the generated files to, defaults to a new temporary one")
+	flags.StringVar(&b.CC, "cc", "", "the C `compiler` to use, defaults to $"+toolchain.Env+" or the first one installed")
+	flags.StringVar(&b.Options.Optimize, "O", "", "the optimization `level` passed to the C compiler")
+	flags.BoolVar(&b.Options.Debug, "g", false, "compile with debug information")
+	flags.BoolVar(&b.Options.Warnings, "Wall", false, "show the C compiler's warnings")
+}
+
+// Run compiles a program and runs it with the arguments after --, connected
+// to the standard streams of whirl.
+func Run(args []string) int {
+	var build BuildFlags
+
+	flags := Command{Name: "run", Description: "Compile and run a program", Usage: "[OPTIONS] <PATH> [-- ARGS...]"}.FlagSet()
+	build.Register(flags)
+
+	path, program, code, ok := Parse(flags, args)
+
+	if !ok {
+		return code
+	}
+
+	workspace, err := NewWorkspace(build.OutDir)
+
+	if err != nil {
+		return fail(err)
+	}
+
+	defer workspace.Close()
+
+	executable := workspace.File(stem(path), false)
+
+	if code := Compile(path, executable, build, workspace); code != 0 {
+		return code
+	}
+
+	cmd := exec.Command(executable, program...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// an interrupt is for the program, whirl still has to clean up after it
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	err = cmd.Run()
+
+	// whirl exits like the program, with what main escaped
+	var exit *exec.ExitError
+
+	if errors.As(err, &exit) {
+		// like shells do for programs killed by a signal
+		if status, ok := exit.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			fmt.Fprintf(os.Stderr, "error: the program was killed by %v\n", status.Signal())
+
+			return 128 + int(status.Signal())
+		}
+
+		return exit.ExitCode()
+	}
+
+	if err != nil {
+		return fail(err)
+	}
+
+	return 0
+}
+
+func Build(args []string) int {
+	var build BuildFlags
+	var output string
+
+	flags := Command{Name: "build", Description: "Compile a program into an executable", Usage: "[OPTIONS] <PATH>"}.FlagSet()
+	build.Register(flags)
+	flags.StringVar(&output, "o", "", "the `path` of the executable, defaults to the name of the file without .whirl")
+
+	path, _, code, ok := Parse(flags, args)
+
+	if !ok {
+		return code
+	}
+
+	if output == "" {
+		output = stem(path)
+	}
+
+	workspace, err := NewWorkspace(build.OutDir)
+
+	if err != nil {
+		return fail(err)
+	}
+
+	defer workspace.Close()
+
+	return Compile(path, output, build, workspace)
+}
+
+func Check(args []string) int {
+	flags := Command{Name: "check", Description: "Check a program for errors without compiling it", Usage: "<PATH>"}.FlagSet()
+
+	path, _, code, ok := Parse(flags, args)
+
+	if !ok {
+		return code
+	}
+
+	file, content, err := read(path)
+
+	if err != nil {
+		return fail(err)
+	}
+
+	diags := diagnostic.NewCollector()
+	pipeline.Check(content, file, diags)
+
+	return report(diags)
+}
+
+func Emit(args []string) int {
+	var stage, output string
+
+	flags := Command{Name: "emit", Description: "Print the output of a stage of the compiler", Usage: "[OPTIONS] <PATH>"}.FlagSet()
+	flags.StringVar(&stage, "stage", "c", "the `stage` to print, one of tokens, ast or c")
+	flags.StringVar(&output, "o", "", "the `path` to write to instead of the standard output")
+
+	path, _, code, ok := Parse(flags, args)
+
+	if !ok {
+		return code
+	}
+
+	file, content, err := read(path)
+
+	if err != nil {
+		return fail(err)
+	}
+
+	var out io.Writer = os.Stdout
+
+	if output != "" {
+		f, err := os.Create(output)
+
+		if err != nil {
+			return fail(err)
+		}
+
+		defer f.Close()
+		out = f
+	}
+
+	diags := diagnostic.NewCollector()
+
+	switch stage {
+	case "tokens":
+		DumpTokens(out, file, content, diags)
+	case "ast":
+		DumpAST(out, pipeline.Load(file, content, diags))
+	case "c":
+		pipeline.TranspileC(content, file, out, diags)
+	default:
+		return fail(fmt.Errorf("unknown stage %s, expected tokens, ast or c", stage))
+	}
+
+	return report(diags)
+}
+
+// Compile compiles a Whirl file into an executable, generating the C code in
+// the workspace. It returns the exit code whirl should exit with.
+func Compile(path string, executable string, build BuildFlags, workspace *Workspace) int {
+	compiler, err := toolchain.Find(build.CC)
+
+	if err != nil {
+		return fail(err)
+	}
+
+	file, content, err := read(path)
+
+	if err != nil {
+		return fail(err)
+	}
+
+	source := workspace.File(stem(path)+".c", build.KeepC)
+	out, err := os.Create(source)
+
+	if err != nil {
+		return fail(err)
+	}
+
+	diags := diagnostic.NewCollector()
+	pipeline.TranspileC(content, file, out, diags)
+	out.Close()
+
+	if code := report(diags); code != 0 {
+		return code
+	}
+
+	if build.KeepC {
+		fmt.Fprintf(os.Stderr, "note: the generated C code is in %s\n", source)
+	}
+
+	output, err := compiler.Build(source, executable, build.Options)
+	os.Stderr.WriteString(output)
+
+	var cc *toolchain.Error
+
+	if errors.As(err, &cc) {
+		return fail(fmt.Errorf("could not compile the generated C code, %v", cc))
+	}
+
+	if err != nil {
+		return fail(err)
+	}
+
+	return 0
+}
+
+// stem returns the name of a file without its directory and extension.
+func stem(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// read returns the absolute path and the content of a file.
+func read(path string) (string, []byte, error) {
+	file, err := filepath.Abs(path)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	content, err := os.ReadFile(file)
+
+	return file, content, err
+}
+
+// report prints the diagnostics and returns 1 if any of them is an error.
+func report(diags *diagnostic.Collector) int {
+	if len(diags.Diagnostics) > 0 {
+		renderer := Renderer{Out: os.Stderr, Color: UseColor(os.Stderr), Sources: diags.Sources}
+		renderer.RenderAll(diags)
+	}
+
+	if diags.HasErrors() {
+		return 1
+	}
+
+	return 0
+}
+
+func fail(err error) int {
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+
+	return 1
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/whirl-lang/whirl/pkg/diagnostic"
+	"github.com/whirl-lang/whirl/pkg/lexer"
+)
+
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[1;31m"
+	colorYellow = "\x1b[1;33m"
+	colorBlue   = "\x1b[1;34m"
+	colorGreen  = "\x1b[1;32m"
+)
+
+// Renderer prints diagnostics as source snippets with carets under the
+// offending code.
+type Renderer struct {
+	Out     io.Writer
+	Color   bool
+	Sources map[string][]byte
+}
+
+// UseColor reports whether colored output should be written to file.
+func UseColor(file *os.File) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+
+	stat, err := file.Stat()
+
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+func (r Renderer) paint(color string, text string) string {
+	if !r.Color {
+		return text
+	}
+
+	return color + text + colorReset
+}
+
+func (r Renderer) severityColor(severity diagnostic.Severity) string {
+	if severity == diagnostic.Warning {
+		return colorYellow
+	}
+
+	return colorRed
+}
+
+// RenderAll prints every diagnostic in diags followed by a summary line.
+func (r Renderer) RenderAll(diags *diagnostic.Collector) {
+	for _, d := range diags.Diagnostics {
+		r.Render(d)
+	}
+
+	if errors := diags.Errors(); errors > 0 {
+		plural := "s"
+
+		if errors == 1 {
+			plural = ""
+		}
+
+		fmt.Fprintf(r.Out, "%s%s\n\n", r.paint(colorRed, "error"), r.paint(colorBold, fmt.Sprintf(": could not compile due to %d previous error%s", errors, plural)))
+	}
+}
+
+func (r Renderer) Render(d diagnostic.Diagnostic) {
+	fmt.Fprintf(r.Out, "%s%s\n", r.paint(r.severityColor(d.Severity), d.Severity.String()), r.paint(colorBold, ": "+d.Message))
+
+	source, ok := r.Sources[d.Span.File]
+
+	if !ok || d.Span.Start.Line == 0 {
+		for _, note := range d.Notes {
+			fmt.Fprintf(r.Out, "%s %s\n", r.paint(colorBlue, "="), "note: "+note)
+		}
+
+		fmt.Fprintln(r.Out)
+
+		return
+	}
+
+	lines := bytes.Split(source, []byte("\n"))
+	width := len(strconv.Itoa(d.Span.Start.Line))
+
+	for _, fix := range d.Fixes {
+		if w := len(strconv.Itoa(fix.Span.Start.Line)); w > width {
+			width = w
+		}
+	}
+
+	gutter := strings.Repeat(" ", width)
+
+	fmt.Fprintf(r.Out, "%s%s %s:%d:%d\n", gutter, r.paint(colorBlue, "-->"), displayPath(d.Span.File), d.Span.Start.Line, d.Span.Start.Column)
+	fmt.Fprintf(r.Out, "%s %s\n", gutter, r.paint(colorBlue, "|"))
+
+	line := sourceLine(lines, d.Span.Start.Line)
+	r.writeLine(width, d.Span.Start.Line, line)
+	r.writeMarker(width, line, d.Span, "^", r.severityColor(d.Severity))
+
+	for _, note := range d.Notes {
+		fmt.Fprintf(r.Out, "%s %s note: %s\n", gutter, r.paint(colorBlue, "="), note)
+	}
+
+	for _, fix := range d.Fixes {
+		r.renderFix(width, lines, fix)
+	}
+
+	fmt.Fprintln(r.Out)
+}
+
+// renderFix prints a suggested fix with the replacement applied to the line.
+func (r Renderer) renderFix(width int, lines [][]byte, fix diagnostic.Fix) {
+	gutter := strings.Repeat(" ", width)
+	line := sourceLine(lines, fix.Span.Start.Line)
+
+	if fix.Span.End.Line != fix.Span.Start.Line || fix.Span.Start.Column-1 > len(line) {
+		fmt.Fprintf(r.Out, "%s %s help: %s: `%s`\n", gutter, r.paint(colorBlue, "="), fix.Message, fix.Replacement)
+
+		return
+	}
+
+	start := fix.Span.Start.Column - 1
+	end := fix.Span.End.Column - 1
+
+	if end > len(line) {
+		end = len(line)
+	}
+
+	fixed := string(line[:start]) + fix.Replacement + string(line[end:])
+	marker := "+"
+
+	if end > start {
+		marker = "~"
+	}
+
+	inserted := fix.Span
+	inserted.End.Column = inserted.Start.Column + len(fix.Replacement)
+
+	fmt.Fprintf(r.Out, "%s%s\n", r.paint(colorBlue, "help"), r.paint(colorBold, ": "+fix.Message))
+	fmt.Fprintf(r.Out, "%s %s\n", gutter, r.paint(colorBlue, "|"))
+	r.writeLine(width, fix.Span.Start.Line, []byte(fixed))
+	r.writeMarker(width, []byte(fixed), inserted, marker, colorGreen)
+}
+
+func (r Renderer) writeLine(width int, number int, line []byte) {
+	fmt.Fprintf(r.Out, "%s %s %s\n", r.paint(colorBlue, fmt.Sprintf("%*d", width, number)), r.paint(colorBlue, "|"), line)
+}
+
+// writeMarker underlines the part of line covered by span. Tabs in the line
+// are kept in the padding so the markers stay aligned.
+func (r Renderer) writeMarker(width int, line []byte, span lexer.Span, marker string, color string) {
+	start := span.Start.Column - 1
+
+	if start > len(line) {
+		start = len(line)
+	}
+
+	end := len(line)
+
+	if span.End.Line == span.Start.Line {
+		end = span.End.Column - 1
+	}
+
+	count := end - start
+
+	if count < 1 {
+		count = 1
+	}
+
+	var padding strings.Builder
+
+	for _, b := range line[:start] {
+		if b == '\t' {
+			padding.WriteByte('\t')
+		} else {
+			padding.WriteByte(' ')
+		}
+	}
+
+	fmt.Fprintf(r.Out, "%s %s %s%s\n", strings.Repeat(" ", width), r.paint(colorBlue, "|"), padding.String(), r.paint(color, strings.Repeat(marker, count)))
+}
+
+func sourceLine(lines [][]byte, number int) []byte {
+	if number < 1 || number > len(lines) {
+		return nil
+	}
+
+	return bytes.TrimRight(lines[number-1], "\r")
+}
+
+// displayPath shortens file to a path relative to the working directory when
+// it lives below it.
+func displayPath(file string) string {
+	dir, err := os.Getwd()
+
+	if err != nil {
+		return file
+	}
+
+	rel, err := filepath.Rel(dir, file)
+
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return file
+	}
+
+	return rel
+}
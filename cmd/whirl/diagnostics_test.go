@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/whirl-lang/whirl/pkg/diagnostic"
+	"github.com/whirl-lang/whirl/pkg/lexer"
+)
+
+// span returns a span of main.whirl from line:column to line:column.
+func span(startLine int, startColumn int, endLine int, endColumn int) lexer.Span {
+	return lexer.Span{
+		File:  "main.whirl",
+		Start: lexer.Position{Line: startLine, Column: startColumn},
+		End:   lexer.Position{Line: endLine, Column: endColumn},
+	}
+}
+
+// render renders d without color for a main.whirl holding source.
+func render(source string, d diagnostic.Diagnostic) string {
+	var out strings.Builder
+
+	renderer := Renderer{Out: &out, Sources: map[string][]byte{"main.whirl": []byte(source)}}
+	renderer.Render(d)
+
+	return out.String()
+}
+
+func TestRenderSingleLine(t *testing.T) {
+	source := "proc main() :: int {\n\tescape x;\n}\n"
+	d := diagnostic.Errorf(span(2, 9, 2, 10), "cannot find x in this scope").WithNote("declare it with let")
+
+	expected := "error: cannot find x in this scope\n" +
+		" --> main.whirl:2:9\n" +
+		"  |\n" +
+		"2 | \tescape x;\n" +
+		"  | \t       ^\n" +
+		"  = note: declare it with let\n" +
+		"\n"
+
+	if got := render(source, d); got != expected {
+		t.Fatalf("expected\n%q, got\n%q", expected, got)
+	}
+}
+
+func TestRenderMultiLine(t *testing.T) {
+	source := strings.Repeat("\n", 9) + "proc main() :: int {\n  escape 0;\n}\n"
+	d := diagnostic.Warningf(span(10, 6, 12, 2), "main is never called")
+
+	expected := "warning: main is never called\n" +
+		"  --> main.whirl:10:6\n" +
+		"   |\n" +
+		"10 | proc main() :: int {\n" +
+		"   |      ^^^^^^^^^^^^^^^\n" +
+		"\n"
+
+	if got := render(source, d); got != expected {
+		t.Fatalf("expected\n%q, got\n%q", expected, got)
+	}
+}
+
+func TestRenderFixes(t *testing.T) {
+	inserted := diagnostic.Errorf(span(1, 10, 1, 10), "expected ;, got EOF").
+		WithFix(span(1, 10, 1, 10), ";", "add a semicolon")
+
+	expected := "error: expected ;, got EOF\n" +
+		" --> main.whirl:1:10\n" +
+		"  |\n" +
+		"1 | let x = 1\n" +
+		"  |          ^\n" +
+		"help: add a semicolon\n" +
+		"  |\n" +
+		"1 | let x = 1;\n" +
+		"  |          +\n" +
+		"\n"
+
+	if got := render("let x = 1\n", inserted); got != expected {
+		t.Fatalf("expected\n%q, got\n%q", expected, got)
+	}
+
+	replaced := diagnostic.Errorf(span(1, 7, 1, 9), "expected =, got ==").
+		WithFix(span(1, 7, 1, 9), "=", "use = to assign")
+
+	expected = "error: expected =, got ==\n" +
+		" --> main.whirl:1:7\n" +
+		"  |\n" +
+		"1 | let x == 1;\n" +
+		"  |       ^^\n" +
+		"help: use = to assign\n" +
+		"  |\n" +
+		"1 | let x = 1;\n" +
+		"  |       ~\n" +
+		"\n"
+
+	if got := render("let x == 1;\n", replaced); got != expected {
+		t.Fatalf("expected\n%q, got\n%q", expected, got)
+	}
+}
+
+func TestRenderAllColor(t *testing.T) {
+	var out strings.Builder
+
+	diags := diagnostic.NewCollector()
+	diags.Report(diagnostic.Diagnostic{Message: "no main procedure", Notes: []string{"declare proc main() :: int"}})
+
+	renderer := Renderer{Out: &out, Color: true, Sources: diags.Sources}
+	renderer.RenderAll(diags)
+
+	expected := colorRed + "error" + colorReset + colorBold + ": no main procedure" + colorReset + "\n" +
+		colorBlue + "=" + colorReset + " note: declare proc main() :: int\n" +
+		"\n" +
+		colorRed + "error" + colorReset + colorBold + ": could not compile due to 1 previous error" + colorReset + "\n" +
+		"\n"
+
+	if got := out.String(); got != expected {
+		t.Fatalf("expected\n%q, got\n%q", expected, got)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/whirl-lang/whirl/pkg/codegen"
+	"github.com/whirl-lang/whirl/pkg/diagnostic"
+	"github.com/whirl-lang/whirl/pkg/lexer"
+)
+
+// DumpTokens writes the tokens of a file, one per line with its position.
+func DumpTokens(out io.Writer, file string, content []byte, diags *diagnostic.Collector) {
+	diags.AddSource(file, content)
+
+	tokens := lexer.Iterator(content)
+	tokens.File = file
+
+	for {
+		token, err := tokens.Next()
+
+		if err != nil {
+			diags.ReportError(err)
+
+			continue
+		}
+
+		fmt.Fprintf(out, "%d:%d\t%s", token.Span.Start.Line, token.Span.Start.Column, lexer.TokensPretty[token.Kind])
+
+		// strings and characters can hold line breaks
+		switch {
+		case token.Kind == lexer.STRING_LIT:
+			fmt.Fprintf(out, "\t%q", token.Value[1:len(token.Value)-1])
+		case token.Kind == lexer.CHAR_LIT:
+			fmt.Fprintf(out, "\t%q", token.Value[0])
+		case token.Value != "" && token.Value != lexer.TokensPretty[token.Kind]:
+			fmt.Fprintf(out, "\t%s", token.Value)
+		}
+
+		fmt.Fprintln(out)
+
+		if token.Kind == lexer.EOF {
+			return
+		}
+	}
+}
+
+// DumpAST writes the instructions of a module as a tree, one field per line.
+func DumpAST(out io.Writer, module *codegen.Module) {
+	for _, instruction := range module.Instructions {
+		dump(out, reflect.ValueOf(instruction), "  ")
+	}
+}
+
+// dump writes a value, indenting the lines of its fields with indent.
+func dump(out io.Writer, value reflect.Value, indent string) {
+	switch value.Kind() {
+	case reflect.Interface:
+		if value.IsNil() {
+			fmt.Fprintln(out, "nil")
+
+			return
+		}
+
+		dump(out, value.Elem(), indent)
+	case reflect.Pointer:
+		if value.IsNil() {
+			fmt.Fprintln(out, "nil")
+
+			return
+		}
+
+		// imported modules are dumped separately
+		if _, ok := value.Interface().(*codegen.Module); ok {
+			fmt.Fprintf(out, "&%s\n", value.Type().Elem().Name())
+
+			return
+		}
+
+		fmt.Fprint(out, "&")
+		dump(out, value.Elem(), indent)
+	case reflect.Slice:
+		if value.Len() == 0 {
+			fmt.Fprintln(out, "[]")
+
+			return
+		}
+
+		fmt.Fprintln(out)
+
+		for i := 0; i < value.Len(); i++ {
+			fmt.Fprintf(out, "%s- ", indent)
+			dump(out, value.Index(i), indent+"  ")
+		}
+	case reflect.Struct:
+		fmt.Fprint(out, value.Type().Name())
+
+		if field := value.FieldByName("Span"); field.IsValid() {
+			if span, ok := field.Interface().(lexer.Span); ok && span.Start.Line > 0 {
+				fmt.Fprintf(out, " %d:%d", span.Start.Line, span.Start.Column)
+			}
+		}
+
+		fmt.Fprintln(out)
+
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+
+			if field.Name == "Span" {
+				continue
+			}
+
+			fmt.Fprintf(out, "%s%s: ", indent, field.Name)
+
+			// operators are token kinds
+			if field.Name == "Op" {
+				fmt.Fprintln(out, lexer.TokensPretty[value.Field(i).Int()])
+
+				continue
+			}
+
+			dump(out, value.Field(i), indent+"  ")
+		}
+	case reflect.Int32:
+		// characters are runes
+		fmt.Fprintf(out, "%q\n", rune(value.Int()))
+	default:
+		fmt.Fprintf(out, "%#v\n", value)
+	}
+}
@@ -1,96 +1,136 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"os"
-	"os/exec"
-	"path"
-
-	"github.com/whirl-lang/whirl/pkg/pipeline"
+	"strings"
 )
 
-type Args struct {
-	args []string
-}
+// Version is the version of the compiler. Releases set it with
+// -ldflags "-X main.Version=...".
+var Version = "dev"
 
-func main() {
-	args := os.Args
+const usage = `A statically typed, compiled programming language.
 
-	if len(args) < 2 {
-		fmt.Println("Usage: whirl <filename> [args]")
-		return
-	}
+Usage: whirl <COMMAND> [OPTIONS] <PATH>
 
-	dir, err := os.Getwd()
+Commands:
+  run    Compile and run a program
+  build  Compile a program into an executable
+  check  Check a program for errors without compiling it
+  emit   Print the output of a stage of the compiler
 
-	if err != nil {
-		panic(err)
-	}
+Options:
+  -h, --help     Print help
+  -V, --version  Print version
 
-	file, err := os.Create("out.c")
+See 'whirl <COMMAND> --help' for the options of a command.
+`
 
-	if err != nil {
-		panic(err)
+func main() {
+	os.Exit(Main(os.Args[1:]))
+}
+
+// Main runs the command line and returns the exit code.
+func Main(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+
+		return 2
 	}
 
-	path := path.Join(dir, args[1])
+	switch args[0] {
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+
+		return 0
+	case "-V", "--version":
+		fmt.Println("whirl", Version)
+
+		return 0
+	case "run":
+		return Run(args[1:])
+	case "build":
+		return Build(args[1:])
+	case "check":
+		return Check(args[1:])
+	case "emit":
+		return Emit(args[1:])
+	}
 
-	ParseFile(path, file)
+	// whirl file.whirl is short for whirl run file.whirl
+	if strings.HasSuffix(args[0], ".whirl") {
+		return Run(args)
+	}
 
-	out := ExecuteFile(path)
-	ParseArgs(Args{args: args}, file)
+	fmt.Fprintf(os.Stderr, "error: unknown command %s\n\n%s", args[0], usage)
 
-	fmt.Println(string(out))
+	return 2
 }
 
-func ParseArgs(args Args, file *os.File) {
-	//TODO: Add proper arg parsing and flags
-	deletingFile := true
-
-	if len(args.args) > 2 {
-		for _, arg := range args.args[2:] {
-			switch arg {
-			case "-c":
-				deletingFile = false
-			}
-		}
-	}
+// Command describes a subcommand for its help text.
+type Command struct {
+	Name        string
+	Description string
+	// Usage is the command line after the name of the command.
+	Usage string
+}
 
-	file.Close()
+// FlagSet returns an empty flag set for the command, whose usage prints the
+// command's help.
+func (c Command) FlagSet() *flag.FlagSet {
+	flags := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "%s\n\nUsage: whirl %s %s\n\nOptions:\n", c.Description, c.Name, c.Usage)
+		flags.PrintDefaults()
+	}
 
-	if deletingFile {
-		err := os.Remove("out.c")
+	return flags
+}
 
-		if err != nil {
-			panic(err)
-		}
+// Parse parses the flags and the path of the file the command works on. Flags
+// may come before or after the path. The arguments after -- are returned as
+// rest. If the command line is invalid or help was asked for, ok is false and
+// code is what whirl should exit with.
+func Parse(flags *flag.FlagSet, args []string) (path string, rest []string, code int, ok bool) {
+	if err := flags.Parse(args); err != nil {
+		return "", nil, parseError(err), false
 	}
-}
 
-func ExecuteFile(path string) []byte {
-	out, _ := exec.Command("tcc", "-run", "out.c").CombinedOutput()
+	if flags.NArg() == 0 {
+		fmt.Fprintf(flags.Output(), "error: no file given\n\n")
+		flags.Usage()
 
-	return out
-}
+		return "", nil, 2, false
+	}
 
-func ParseFile(filename string, out io.Writer) {
-	file, err := os.Open(filename)
+	path = flags.Arg(0)
+	after := flags.Args()[1:]
 
-	if err != nil {
-		panic(err)
+	if err := flags.Parse(after); err != nil {
+		return "", nil, parseError(err), false
 	}
 
-	defer file.Close()
+	rest = flags.Args()
 
-	stat, err := file.Stat()
+	// only the arguments after -- are left over on purpose
+	if separator := len(after) - len(rest) - 1; len(rest) > 0 && (separator < 0 || after[separator] != "--") {
+		fmt.Fprintf(flags.Output(), "error: unexpected argument %s\n\n", rest[0])
+		flags.Usage()
 
-	if err != nil {
-		panic(err)
+		return "", nil, 2, false
 	}
 
-	bytes := make([]byte, stat.Size())
-	file.Read(bytes)
+	return path, rest, 0, true
+}
+
+func parseError(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
 
-	pipeline.TranspileC(bytes, path.Dir(filename), out)
+	return 2
 }
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseFlagsAroundPath(t *testing.T) {
+	var build BuildFlags
+
+	flags := Command{Name: "run"}.FlagSet()
+	flags.SetOutput(io.Discard)
+	build.Register(flags)
+
+	path, rest, _, ok := Parse(flags, []string{"-cc", "gcc", "main.whirl", "-g", "--", "-x", "y"})
+
+	if !ok || path != "main.whirl" || build.CC != "gcc" || !build.Options.Debug {
+		t.Fatalf("unexpected result %q %+v", path, build)
+	}
+
+	if strings.Join(rest, " ") != "-x y" {
+		t.Fatalf("expected the arguments after --, got %q", rest)
+	}
+}
+
+func TestParseRejectsStrayArguments(t *testing.T) {
+	flags := Command{Name: "check"}.FlagSet()
+	flags.SetOutput(io.Discard)
+
+	if _, _, code, ok := Parse(flags, []string{"main.whirl", "other.whirl"}); ok || code != 2 {
+		t.Fatalf("expected a usage error, got %d", code)
+	}
+
+	if _, _, code, ok := Parse(flags, []string{}); ok || code != 2 {
+		t.Fatalf("expected a usage error without a file, got %d", code)
+	}
+
+	if _, _, code, ok := Parse(flags, []string{"-h"}); ok || code != 0 {
+		t.Fatalf("expected help to exit with 0, got %d", code)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Workspace is the directory a build writes its generated C code and
+// executables to. Unless another one is given it is a new temporary
+// directory, so builds running at the same time don't clobber each other.
+type Workspace struct {
+	Dir string
+
+	// temporary is set if Dir was created for this build
+	temporary bool
+	// remove are the files that Close deletes
+	remove []string
+}
+
+// NewWorkspace creates a workspace in dir, or in a temporary directory if dir
+// is empty.
+func NewWorkspace(dir string) (*Workspace, error) {
+	if dir != "" {
+		return &Workspace{Dir: dir}, os.MkdirAll(dir, 0o755)
+	}
+
+	dir, err := os.MkdirTemp("", "whirl-")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Workspace{Dir: dir, temporary: true}, nil
+}
+
+// File returns the path of a file in the workspace, which is deleted by Close
+// unless keep is set.
+func (w *Workspace) File(name string, keep bool) string {
+	path := filepath.Join(w.Dir, name)
+
+	if !keep {
+		w.remove = append(w.remove, path)
+	}
+
+	return path
+}
+
+// Close deletes the files that aren't kept, and the workspace itself if it
+// is temporary and nothing in it is kept.
+func (w *Workspace) Close() {
+	for _, file := range w.remove {
+		os.Remove(file)
+	}
+
+	if w.temporary {
+		// fails if any file is kept
+		os.Remove(w.Dir)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestWorkspaceCleansUp(t *testing.T) {
+	workspace, err := NewWorkspace("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generated := workspace.File("main.c", false)
+	os.WriteFile(generated, []byte("int main(void) { return 0; }"), 0o644)
+	workspace.Close()
+
+	if _, err := os.Stat(workspace.Dir); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed, got %v", workspace.Dir, err)
+	}
+}
+
+func TestWorkspaceKeepsFiles(t *testing.T) {
+	dir := t.TempDir()
+	workspace, err := NewWorkspace(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kept := workspace.File("main.c", true)
+	removed := workspace.File("main", false)
+	os.WriteFile(kept, nil, 0o644)
+	os.WriteFile(removed, nil, 0o755)
+	workspace.Close()
+
+	if _, err := os.Stat(kept); err != nil {
+		t.Fatalf("expected %s to be kept, got %v", kept, err)
+	}
+
+	if _, err := os.Stat(removed); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed, got %v", removed, err)
+	}
+}
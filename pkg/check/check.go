@@ -0,0 +1,781 @@
+package check
+
+import (
+	"path/filepath"
+
+	"github.com/whirl-lang/whirl/pkg/codegen"
+	"github.com/whirl-lang/whirl/pkg/diagnostic"
+	"github.com/whirl-lang/whirl/pkg/lexer"
+)
+
+// Checker resolves the names and verifies the types of a program before it
+// is handed to codegen. Every problem is reported as a diagnostic.
+type Checker struct {
+	Diagnostics *diagnostic.Collector
+
+	// modules maps every module to the scope of its top-level symbols
+	modules map[*codegen.Module]*Scope
+	// declared holds the symbols of the top-level declarations of each
+	// module, indexed like its instructions
+	declared map[*codegen.Module][]*Symbol
+
+	// keys holds the map types resolved before the fields of every struct
+	// are, whose key types are checked once they are
+	keys []codegen.Map
+	// signed is set once the signatures of every module are resolved
+	signed bool
+
+	module     *codegen.Module
+	scope      *Scope
+	returnType codegen.Type
+}
+
+// prelude is the scope every module scope is nested in.
+func prelude() *Scope {
+	scope := NewScope(nil)
+	scope.Declare(&Symbol{Kind: Builtin, Name: "printf", Type: codegen.Int{}})
+	scope.Declare(&Symbol{Kind: Builtin, Name: "len", Type: codegen.Int{}})
+	scope.Declare(&Symbol{Kind: Builtin, Name: "to_string", Type: codegen.String{}})
+	scope.Declare(&Symbol{Kind: Builtin, Name: "parse_int", Type: codegen.Int{}})
+
+	return scope
+}
+
+// Check checks a module and everything it imports.
+func Check(module *codegen.Module, diags *diagnostic.Collector) {
+	checker := Checker{
+		Diagnostics: diags,
+		modules:     map[*codegen.Module]*Scope{},
+		declared:    map[*codegen.Module][]*Symbol{},
+	}
+
+	modules := module.Dependencies()
+	builtins := prelude()
+
+	// declarations first, so they can be used before they are defined
+	for _, module := range modules {
+		checker.modules[module] = NewScope(builtins)
+	}
+
+	for _, module := range modules {
+		checker.enter(module)
+		checker.Declarations(module)
+	}
+
+	for _, module := range modules {
+		checker.enter(module)
+		checker.Signatures(module)
+	}
+
+	// after all signatures, as a type can contain itself through the types
+	// of other modules
+	for _, module := range modules {
+		checker.enter(module)
+		checker.Sizes(module)
+	}
+
+	checker.signed = true
+
+	for _, m := range checker.keys {
+		checker.key(m)
+	}
+
+	checker.EntryPoints(module, modules)
+
+	for _, module := range modules {
+		checker.enter(module)
+
+		for i, instruction := range module.Instructions {
+			if procedure, ok := instruction.(codegen.Procedure); ok {
+				checker.Procedure(procedure, checker.declared[module][i])
+			} else {
+				module.Instructions[i] = checker.Instruction(instruction)
+			}
+		}
+	}
+}
+
+func (c *Checker) enter(module *codegen.Module) {
+	c.module = module
+	c.scope = c.modules[module]
+}
+
+// Declarations declares the imports, structs, enums and procedures of a
+// module.
+func (c *Checker) Declarations(module *codegen.Module) {
+	symbols := make([]*Symbol, len(module.Instructions))
+
+	for i, instruction := range module.Instructions {
+		var symbol *Symbol
+
+		switch instruction := instruction.(type) {
+		case codegen.Import:
+			if instruction.Module == nil {
+				continue
+			}
+
+			symbol = &Symbol{Kind: Module, Name: instruction.Module.Name, Span: instruction.Span, Module: instruction.Module}
+		case codegen.Struct:
+			ident := instruction.Ident.Tokens[len(instruction.Ident.Tokens)-1]
+			symbol = &Symbol{Kind: Struct, Name: ident.Name, Span: ident.Span, Module: module, Methods: NewScope(nil)}
+			symbol.Type = structType{Symbol: symbol}
+		case codegen.Enum:
+			ident := instruction.Ident.Tokens[len(instruction.Ident.Tokens)-1]
+			symbol = &Symbol{Kind: Enum, Name: ident.Name, Span: ident.Span, Module: module, Variants: NewScope(nil)}
+			symbol.Type = enumType{Symbol: symbol}
+		case codegen.Procedure:
+			symbol = &Symbol{Kind: Procedure, Name: instruction.Ident.Name, Span: instruction.Ident.Span, Module: module}
+
+			// methods are declared on their struct, once all structs are
+			if instruction.Receiver != nil {
+				symbols[i] = symbol
+
+				continue
+			}
+		default:
+			continue
+		}
+
+		c.declare(symbol)
+		symbols[i] = symbol
+	}
+
+	for i, instruction := range module.Instructions {
+		if procedure, ok := instruction.(codegen.Procedure); ok && procedure.Receiver != nil {
+			c.method(procedure, symbols[i])
+		}
+	}
+
+	c.declared[module] = symbols
+}
+
+// method declares a method on the struct it names, which must be declared in
+// the same module.
+func (c *Checker) method(procedure codegen.Procedure, symbol *Symbol) {
+	structure := c.receiver(procedure)
+
+	if structure == nil {
+		receiver := c.scope.Symbols[procedure.Receiver.Name]
+
+		if receiver == nil {
+			c.undefined(*procedure.Receiver, c.scope, false)
+		} else {
+			c.errorf(*procedure.Receiver, "methods can only be declared on structs, %s is a %s", receiver.Name, receiver.Kind)
+		}
+
+		return
+	}
+
+	if previous := structure.Methods.Declare(symbol); previous != nil {
+		c.Diagnostics.Report(diagnostic.Errorf(symbol.Span, "%s already has a method %s", structure.Name, symbol.Name).
+			WithNote("the previous declaration of %s is on line %d", previous.Name, previous.Span.Start.Line))
+	}
+}
+
+// receiver returns the struct a method is declared on, or nil if there is no
+// struct of that name in the current module.
+func (c *Checker) receiver(procedure codegen.Procedure) *Symbol {
+	symbol := c.scope.Symbols[procedure.Receiver.Name]
+
+	if symbol == nil || symbol.Kind != Struct {
+		return nil
+	}
+
+	return symbol
+}
+
+// Signatures resolves the field types of structs and variants and the
+// argument and return types of procedures, and writes them back for codegen.
+func (c *Checker) Signatures(module *codegen.Module) {
+	for i, instruction := range module.Instructions {
+		symbol := c.declared[module][i]
+
+		switch instruction := instruction.(type) {
+		case codegen.Struct:
+			seen := map[string]bool{}
+
+			for j, field := range instruction.Fields {
+				if seen[field.Ident.Name] {
+					c.errorf(field.Ident, "field %s is declared twice", field.Ident.Name)
+				}
+
+				if method := symbol.Methods.Symbols[field.Ident.Name]; method != nil {
+					c.Diagnostics.Report(diagnostic.Errorf(method.Span, "%s has both a field and a method named %s", symbol.Name, method.Name))
+				}
+
+				seen[field.Ident.Name] = true
+				instruction.Fields[j].Type = c.Resolve(field.Type)
+				c.holds(field.Ident, instruction.Fields[j].Type)
+				symbol.Fields = append(symbol.Fields, instruction.Fields[j])
+			}
+		case codegen.Enum:
+			for j, variant := range instruction.Variants {
+				seen := map[string]bool{}
+				declared := &Symbol{Kind: Variant, Name: variant.Ident.Name, Span: variant.Ident.Span, Type: symbol.Type, Tag: j, Module: module}
+
+				for k, field := range variant.Fields {
+					if seen[field.Ident.Name] {
+						c.errorf(field.Ident, "field %s is declared twice", field.Ident.Name)
+					}
+
+					seen[field.Ident.Name] = true
+					variant.Fields[k].Type = c.Resolve(field.Type)
+					c.holds(field.Ident, variant.Fields[k].Type)
+					declared.Fields = append(declared.Fields, variant.Fields[k])
+					declared.Args = append(declared.Args, variant.Fields[k].Type)
+				}
+
+				if symbol.Variants.Declare(declared) != nil {
+					c.errorf(variant.Ident, "variant %s is declared twice", variant.Ident.Name)
+				}
+			}
+		case codegen.Procedure:
+			for j, arg := range instruction.Args {
+				instruction.Args[j].Type = c.Resolve(arg.Type)
+
+				if arg.Ident.Name == "self" {
+					instruction.Args[j].Type = c.self(instruction, j, instruction.Args[j].Type)
+					symbol.Self = instruction.Receiver != nil && j == 0
+				}
+
+				c.stores(arg.Ident, instruction.Args[j].Type)
+				symbol.Args = append(symbol.Args, instruction.Args[j].Type)
+			}
+
+			instruction.ReturnType = c.Resolve(instruction.ReturnType)
+
+			if holdsReference(instruction.ReturnType) {
+				c.Diagnostics.Report(diagnostic.Errorf(instruction.Ident.Span, "%s cannot return a reference", instruction.Ident.Name).
+					WithNote("it could refer to a variable of %s, which no longer exists once it returns", instruction.Ident.Name))
+			}
+
+			symbol.Type = instruction.ReturnType
+			module.Instructions[i] = instruction
+		}
+	}
+}
+
+// Sizes reports the structs and enums that contain themselves, which would
+// need infinite space. A Vec of them has a size, as its elements are on the
+// heap.
+func (c *Checker) Sizes(module *codegen.Module) {
+	for i, instruction := range module.Instructions {
+		symbol := c.declared[module][i]
+
+		switch instruction := instruction.(type) {
+		case codegen.Struct:
+			c.size(symbol, symbol)
+		case codegen.Enum:
+			for _, variant := range instruction.Variants {
+				c.size(symbol, symbol.Variants.Symbols[variant.Ident.Name])
+			}
+		}
+	}
+}
+
+// size reports the fields of a struct or variant through which typ contains
+// itself. Their types are forgotten, so the cycle isn't followed later on.
+func (c *Checker) size(typ *Symbol, holder *Symbol) {
+	for i, field := range holder.Fields {
+		inner := named(field.Type)
+
+		if inner == nil || (inner != typ && !contains(inner, typ, map[*Symbol]bool{})) {
+			continue
+		}
+
+		c.Diagnostics.Report(diagnostic.Errorf(field.Span, "%s contains itself, so it has no size", typ.Name).
+			WithNote("store it in a vector instead, like %s: Vec<%s>", field.Ident.Name, Name(field.Type)))
+
+		holder.Fields[i].Type = unknown{}
+
+		if holder.Kind == Variant {
+			holder.Args[i] = unknown{}
+		}
+	}
+}
+
+// contains reports whether a value of the struct or enum from holds a value
+// of target, other than through the heap.
+func contains(from *Symbol, target *Symbol, visited map[*Symbol]bool) bool {
+	if visited[from] {
+		return false
+	}
+
+	visited[from] = true
+	holders := []*Symbol{from}
+
+	if from.Kind == Enum {
+		holders = nil
+
+		for _, variant := range from.Variants.Symbols {
+			holders = append(holders, variant)
+		}
+	}
+
+	for _, holder := range holders {
+		for _, field := range holder.Fields {
+			inner := named(field.Type)
+
+			if inner != nil && (inner == target || contains(inner, target, visited)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// named returns the declaration of a struct or enum type, or nil for other
+// types.
+func named(typ codegen.Type) *Symbol {
+	switch t := typ.(type) {
+	case structType:
+		return t.Symbol
+	case enumType:
+		return t.Symbol
+	}
+
+	return nil
+}
+
+// self returns the type of the self argument of a procedure, which can only
+// be the first argument of a method and is of the type of its struct. typ is
+// the resolved type it is written with, or nil.
+func (c *Checker) self(procedure codegen.Procedure, index int, typ codegen.Type) codegen.Type {
+	arg := procedure.Args[index]
+
+	if procedure.Receiver == nil || index != 0 {
+		c.errorf(arg, "self can only be the first argument of a method")
+
+		return unknown{}
+	}
+
+	structure := c.receiver(procedure)
+
+	if structure == nil {
+		return unknown{}
+	}
+
+	if typ == nil {
+		return structure.Type
+	}
+
+	// self can also be a reference, to change the value or avoid a copy
+	if reference, ok := typ.(codegen.Reference); ok && Equal(reference.Type, structure.Type) {
+		return typ
+	}
+
+	if !Equal(typ, structure.Type) {
+		c.errorf(arg, "self must be of type %s, &%s or &mut %s", structure.Name, structure.Name, structure.Name)
+	}
+
+	return structure.Type
+}
+
+// holds reports an error if a field of a struct or a variant holds a
+// reference, as the value could outlive what the reference refers to.
+func (c *Checker) holds(ident codegen.Ident, typ codegen.Type) {
+	if holdsReference(typ) {
+		c.Diagnostics.Report(diagnostic.Errorf(ident.Span, "field %s cannot hold a reference", ident.Name).
+			WithNote("only variables and arguments can be references, so that they can't outlive what they refer to"))
+	}
+}
+
+// stores reports an error if a variable or an argument of the type keeps a
+// reference inside another value, like a vector of references, which could
+// outlive what the reference refers to.
+func (c *Checker) stores(ident codegen.Ident, typ codegen.Type) {
+	if reference, ok := typ.(codegen.Reference); ok {
+		typ = reference.Type
+	}
+
+	if holdsReference(typ) {
+		c.Diagnostics.Report(diagnostic.Errorf(ident.Span, "%s cannot keep a reference inside a value of type %s", ident.Name, Name(typ)).
+			WithNote("only variables and arguments can be references, so that they can't outlive what they refer to"))
+	}
+}
+
+// EntryPoints checks that the main module declares main with one of the two
+// signatures it can have, and that no other module declares it.
+func (c *Checker) EntryPoints(main *codegen.Module, modules []*codegen.Module) {
+	for _, module := range modules {
+		symbol := c.modules[module].Symbols["main"]
+
+		if module != main {
+			if symbol != nil {
+				c.Diagnostics.Report(diagnostic.Errorf(symbol.Span, "only the main module can declare main"))
+			}
+
+			continue
+		}
+
+		if symbol == nil {
+			c.Diagnostics.Report(diagnostic.Errorf(lexer.Span{File: module.Path}, "%s has no main procedure", filepath.Base(module.Path)).
+				WithNote("the program starts at proc main() :: int or proc main(args: string[]) :: int"))
+
+			continue
+		}
+
+		if symbol.Kind != Procedure {
+			c.Diagnostics.Report(diagnostic.Errorf(symbol.Span, "main must be a procedure"))
+
+			continue
+		}
+
+		args := codegen.Array{Type: codegen.String{}}
+		valid := Equal(symbol.Type, codegen.Int{}) &&
+			(len(symbol.Args) == 0 || (len(symbol.Args) == 1 && Equal(symbol.Args[0], args)))
+
+		if !valid {
+			c.Diagnostics.Report(diagnostic.Errorf(symbol.Span, "main has the wrong signature").
+				WithNote("main must be declared as proc main() :: int or proc main(args: string[]) :: int"))
+		}
+	}
+}
+
+func (c *Checker) errorf(node interface{}, format string, args ...interface{}) {
+	c.Diagnostics.Report(diagnostic.Errorf(codegen.SpanOf(node), format, args...))
+}
+
+// expect reports an error if an expression of type got is used where a value
+// of type expected is needed. Number literals take the type expected of them
+// if they can.
+func (c *Checker) expect(node interface{}, expected codegen.Type, got codegen.Type) {
+	if expr, ok := node.(codegen.Expr); ok && adapts(expr, expected) {
+		c.fits(expr, expected)
+
+		return
+	}
+
+	if !assignable(expected, got) {
+		c.errorf(node, "mismatched types: expected %s, got %s", Name(expected), Name(got))
+	}
+}
+
+// declare adds a symbol to the current scope, reporting duplicates and
+// variables that shadow a symbol of an enclosing scope.
+func (c *Checker) declare(symbol *Symbol) {
+	if previous := c.scope.Declare(symbol); previous != nil {
+		c.Diagnostics.Report(diagnostic.Errorf(symbol.Span, "%s is already declared in this scope", symbol.Name).
+			WithNote("the previous declaration of %s is on line %d", previous.Name, previous.Span.Start.Line))
+
+		return
+	}
+
+	if symbol.Kind != Variable || c.scope.Parent == nil {
+		return
+	}
+
+	shadowed := c.scope.Parent.Lookup(symbol.Name)
+
+	if shadowed == nil {
+		return
+	}
+
+	warning := diagnostic.Warningf(symbol.Span, "%s shadows the %s %s", symbol.Name, shadowed.Kind, shadowed.Name)
+
+	if shadowed.Kind != Builtin {
+		warning = warning.WithNote("%s is declared on line %d", shadowed.Name, shadowed.Span.Start.Line)
+	}
+
+	c.Diagnostics.Report(warning)
+}
+
+// undefined reports a name that isn't declared in scope, suggesting a
+// similar one if there is any.
+func (c *Checker) undefined(ident codegen.Ident, scope *Scope, parents bool) {
+	err := diagnostic.Errorf(ident.Span, "cannot find %s in this scope", ident.Name)
+
+	if similar := scope.Similar(ident.Name, parents); similar != "" {
+		err = err.WithFix(ident.Span, similar, "a symbol with a similar name exists")
+	}
+
+	c.Diagnostics.Report(err)
+}
+
+// Lookup finds the symbol a path refers to, reporting an error if there is
+// none. All but the last token of the path must name imported modules, except
+// that the last two can be an enum and one of its variants.
+func (c *Checker) Lookup(path codegen.Path) *Symbol {
+	scope := c.scope
+
+	for i, token := range path.Tokens {
+		var symbol *Symbol
+
+		if i == 0 {
+			symbol = scope.Lookup(token.Name)
+		} else {
+			symbol = scope.Symbols[token.Name]
+		}
+
+		if symbol == nil {
+			c.undefined(token, scope, i == 0)
+
+			return nil
+		}
+
+		if i == len(path.Tokens)-1 {
+			return symbol
+		}
+
+		switch symbol.Kind {
+		case Module:
+			scope = c.modules[symbol.Module]
+		case Enum:
+			if i != len(path.Tokens)-2 {
+				c.errorf(path.Tokens[i+1], "%s is a variant of %s, not a module", path.Tokens[i+1].Name, token.Name)
+
+				return nil
+			}
+
+			scope = symbol.Variants
+		default:
+			c.errorf(token, "%s is a %s, not a module", token.Name, symbol.Kind)
+
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// Body checks a block of instructions in a new scope.
+func (c *Checker) Body(instructions []codegen.Instruction) {
+	c.scope = NewScope(c.scope)
+
+	for i, instruction := range instructions {
+		instructions[i] = c.Instruction(instruction)
+	}
+
+	c.scope = c.scope.Parent
+}
+
+// Instruction checks an instruction and returns it with the types of its
+// variables resolved, so that codegen doesn't have to look them up.
+func (c *Checker) Instruction(instruction codegen.Instruction) codegen.Instruction {
+	switch i := instruction.(type) {
+	case codegen.Import, codegen.Struct, codegen.Enum, codegen.Procedure:
+		if c.scope != c.modules[c.module] {
+			c.errorf(i, "this can only be declared at the top level of a module")
+		}
+	case codegen.Assignment:
+		i.Expr, i.Type = c.Assignment(i)
+		c.stores(i.Ident, i.Type)
+
+		if address, ok := i.Expr.(codegen.AddressOf); ok && inVec(address.Expr) {
+			c.Diagnostics.Report(diagnostic.Errorf(address.Span, "cannot keep a reference to an element of a vector").
+				WithNote("a vector moves its elements when it grows, so pass the reference to a procedure directly instead"))
+		}
+
+		c.declare(&Symbol{Kind: Variable, Name: i.Ident.Name, Span: i.Ident.Span, Type: i.Type, Module: c.module})
+
+		return i
+	case codegen.Reassign:
+		var typ codegen.Type
+
+		i.Target, typ = c.Target(i.Target)
+		i.Expr = c.Typed(i.Expr, typ)
+
+		if _, ok := typ.(codegen.Reference); ok {
+			c.Diagnostics.Report(diagnostic.Errorf(codegen.SpanOf(i.Target), "cannot change what a reference refers to").
+				WithNote("a reference is only set by let, so that it can't outlive what it refers to"))
+		}
+
+		return i
+	case codegen.Escape:
+		if _, ok := c.returnType.(codegen.Void); ok {
+			c.errorf(i.Expr, "cannot escape a value from a procedure returning void")
+			c.Expr(i.Expr, nil)
+
+			return i
+		}
+
+		i.Expr = c.Typed(i.Expr, c.returnType)
+
+		return i
+	case codegen.If:
+		i.Condition = c.Condition(i.Condition)
+		c.Body(i.Body)
+		c.Body(i.Else)
+
+		return i
+	case codegen.Until:
+		i.Condition = c.Condition(i.Condition)
+		c.Body(i.Body)
+
+		return i
+	case codegen.Iter:
+		var element codegen.Type
+		var index codegen.Type = codegen.Int{}
+		var mutable bool
+
+		i.Iterable, i.Type, mutable = c.operand(i.Iterable)
+
+		switch t := i.Type.(type) {
+		case codegen.Array:
+			element = t.Type
+		case codegen.Vec:
+			element = t.Type
+		case codegen.Map:
+			// iter key, value in m
+			element = t.Key
+
+			if i.Index != nil {
+				index, element = t.Key, t.Value
+			}
+		case codegen.String:
+			element = codegen.Char{}
+		case codegen.Range, unknown:
+			element = codegen.Int{}
+		default:
+			c.errorf(i.Iterable, "cannot iterate over a value of type %s", Name(i.Type))
+			element = unknown{}
+		}
+
+		c.scope = NewScope(c.scope)
+
+		if i.Index != nil {
+			c.declare(&Symbol{Kind: Variable, Name: i.Index.Name, Span: i.Index.Span, Type: index, Module: c.module})
+		}
+
+		c.declare(&Symbol{Kind: Variable, Name: i.Ident.Name, Span: i.Ident.Span, Type: element, Module: c.module})
+		c.copyOut(i.Ident, element, mutable)
+		c.Body(i.Body)
+		c.scope = c.scope.Parent
+
+		return i
+	case codegen.Match:
+		i, _ = c.Match(i, false)
+
+		return i
+	case codegen.Call:
+		expr, _ := c.Expr(i, nil)
+
+		// builtins can be lowered to other expressions
+		if call, ok := expr.(codegen.Call); ok {
+			return call
+		}
+
+		return codegen.Discard{Expr: expr, Span: i.Span}
+	}
+
+	return instruction
+}
+
+// Assignment returns the value of a let along with the type of the variable
+// it declares, which is inferred from the value if it isn't written.
+func (c *Checker) Assignment(assignment codegen.Assignment) (codegen.Expr, codegen.Type) {
+	if assignment.Type != nil {
+		typ := c.Resolve(assignment.Type)
+
+		return c.Typed(assignment.Expr, typ), typ
+	}
+
+	if array, ok := assignment.Expr.(codegen.Array); ok && len(array.Value) == 0 {
+		c.Diagnostics.Report(diagnostic.Errorf(assignment.Ident.Span, "cannot infer the type of %s from an empty array", assignment.Ident.Name).
+			WithNote("give %s a type, like let %s: int[] = []", assignment.Ident.Name, assignment.Ident.Name))
+
+		return assignment.Expr, unknown{}
+	}
+
+	if m, ok := assignment.Expr.(codegen.Map); ok && len(m.Keys) == 0 {
+		c.Diagnostics.Report(diagnostic.Errorf(assignment.Ident.Span, "cannot infer the type of %s from an empty map", assignment.Ident.Name).
+			WithNote("give %s a type, like let %s: map<string, int> = {}", assignment.Ident.Name, assignment.Ident.Name))
+
+		return assignment.Expr, unknown{}
+	}
+
+	expr, typ := c.Expr(assignment.Expr, nil)
+
+	if _, ok := typ.(codegen.Void); ok {
+		c.errorf(assignment.Expr, "cannot assign a value of type void to %s", assignment.Ident.Name)
+
+		return expr, unknown{}
+	}
+
+	c.fits(expr, typ)
+
+	return expr, typ
+}
+
+func (c *Checker) Procedure(p codegen.Procedure, symbol *Symbol) {
+	c.returnType = symbol.Type
+	c.scope = NewScope(c.scope)
+
+	for i, arg := range p.Args {
+		c.declare(&Symbol{Kind: Variable, Name: arg.Ident.Name, Span: arg.Ident.Span, Type: symbol.Args[i], Module: c.module})
+	}
+
+	// the body shares the scope of the arguments, like in C
+	for i, instruction := range p.Instructions {
+		p.Instructions[i] = c.Instruction(instruction)
+	}
+
+	c.scope = c.scope.Parent
+	c.returnType = nil
+}
+
+// key reports an error if the keys of a map type can't be hashed.
+func (c *Checker) key(m codegen.Map) {
+	if !isKey(m.Key) {
+		c.Diagnostics.Report(diagnostic.Errorf(m.Span, "cannot use values of type %s as map keys", Name(m.Key)).
+			WithNote("keys can be of type int, char, bool or string, or structs of them"))
+	}
+}
+
+// Condition checks that the condition of an if or until is a bool and
+// returns it rewritten.
+func (c *Checker) Condition(condition codegen.Expr) codegen.Expr {
+	condition, typ := c.Expr(condition, codegen.Bool{})
+
+	if !Equal(typ, codegen.Bool{}) {
+		c.errorf(condition, "expected a bool condition, got %s", Name(typ))
+	}
+
+	return condition
+}
+
+// Resolve turns a written type into the type it names, returning unknown if
+// it doesn't name one.
+func (c *Checker) Resolve(typ codegen.Type) codegen.Type {
+	var path codegen.Path
+
+	switch t := typ.(type) {
+	case codegen.Array:
+		return codegen.Array{Type: c.Resolve(t.Type), Span: t.Span}
+	case codegen.Vec:
+		return codegen.Vec{Type: c.Resolve(t.Type), Span: t.Span}
+	case codegen.Map:
+		m := codegen.Map{Key: c.Resolve(t.Key), Value: c.Resolve(t.Value), Span: t.Span}
+
+		if c.signed {
+			c.key(m)
+		} else {
+			c.keys = append(c.keys, m)
+		}
+
+		return m
+	case codegen.Reference:
+		return codegen.Reference{Type: c.Resolve(t.Type), Mutable: t.Mutable, Span: t.Span}
+	case codegen.Ident:
+		path = codegen.Path{Tokens: []codegen.Ident{t}, Span: t.Span}
+	case codegen.Path:
+		path = t
+	default:
+		return typ
+	}
+
+	symbol := c.Lookup(path)
+
+	if symbol == nil {
+		return unknown{}
+	}
+
+	if symbol.Kind != Struct && symbol.Kind != Enum {
+		c.errorf(path, "%s is a %s, not a type", symbol.Name, symbol.Kind)
+
+		return unknown{}
+	}
+
+	return symbol.Type
+}
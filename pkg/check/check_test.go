@@ -0,0 +1,907 @@
+package check
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/whirl-lang/whirl/pkg/codegen"
+	"github.com/whirl-lang/whirl/pkg/diagnostic"
+	"github.com/whirl-lang/whirl/pkg/lexer"
+	"github.com/whirl-lang/whirl/pkg/parser"
+)
+
+func TestCheckValidProgram(t *testing.T) {
+	diags := CheckSource(`
+struct Point {
+	x: int,
+	y: int,
+}
+
+proc main() :: int {
+	let p: Point = Point { x: 1, y: 2, };
+	let values: int[] = [p.x, p.y, 3];
+
+	iter i in 0:3 {
+		if values[i] == 2 && !(i > 1) {
+			printf("%d\n", values[i] + square(i));
+		}
+	}
+
+	escape 0;
+}
+
+proc square(n: int) :: int {
+	escape n * n;
+}`)
+
+	if len(diags.Diagnostics) != 0 {
+		t.Fatalf("expected no diagnostics, got %v", diags.Diagnostics)
+	}
+}
+
+func TestCheckMismatches(t *testing.T) {
+	diags := CheckSource(`
+proc answer() :: int {
+	escape "x";
+}
+
+proc main() :: int {
+	let c: bool = "hello";
+	let n: int = 1;
+	n = true;
+
+	if n {
+		escape 1;
+	}
+
+	answer(n);
+	escape n;
+}`)
+
+	expected := []string{
+		"mismatched types: expected int, got string",
+		"mismatched types: expected bool, got string",
+		"mismatched types: expected int, got bool",
+		"expected a bool condition, got int",
+		"answer takes 0 arguments, got 1",
+	}
+
+	if len(diags.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Diagnostics)
+	}
+
+	for i, message := range expected {
+		if diags.Diagnostics[i].Message != message {
+			t.Fatalf("expected %q, got %q", message, diags.Diagnostics[i].Message)
+		}
+	}
+}
+
+func TestCheckInference(t *testing.T) {
+	diags := diagnostic.NewCollector()
+	module := codegen.Module{
+		Name: "main",
+		Instructions: parser.Parse(lexer.Iterator([]byte(`
+struct Point {
+	x: int,
+	y: int,
+}
+
+proc main() :: int {
+	let n = 1 + 2;
+	let p = Point { x: n, y: 2, };
+	let names = ["a", "b"];
+	let ok = n == p.y;
+	escape 0;
+}`)), diags),
+		Imports: map[string]*codegen.Module{},
+	}
+
+	Check(&module, diags)
+
+	if len(diags.Diagnostics) != 0 {
+		t.Fatalf("expected no diagnostics, got %v", diags.Diagnostics)
+	}
+
+	expected := []string{"int", "Point", "string[]", "bool"}
+	body := module.Instructions[1].(codegen.Procedure).Instructions
+
+	for i, name := range expected {
+		if typ := body[i].(codegen.Assignment).Type; Name(typ) != name {
+			t.Fatalf("expected variable %d to be inferred as %s, got %s", i, name, Name(typ))
+		}
+	}
+}
+
+func TestCheckAssignmentTargets(t *testing.T) {
+	diags := CheckSource(`
+struct Point {
+	x: int,
+}
+
+proc origin() :: Point {
+	escape Point { x: 0, };
+}
+
+proc main() :: int {
+	let p = origin();
+	let s = "abc";
+	p.x = origin().x + 1;
+	p.x = "one";
+	s[0] = 'x';
+	origin().x = 1;
+	escape 0;
+}`)
+
+	expected := []string{
+		"mismatched types: expected int, got string",
+		"cannot assign to a character of a string",
+		"cannot assign to this expression",
+	}
+
+	if len(diags.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Diagnostics)
+	}
+
+	for i, message := range expected {
+		if diags.Diagnostics[i].Message != message {
+			t.Fatalf("expected %q, got %q", message, diags.Diagnostics[i].Message)
+		}
+	}
+}
+
+func TestCheckMainSignature(t *testing.T) {
+	valid := []string{
+		"proc main() :: int { escape 0; }",
+		"proc main(args: string[]) :: int { escape 0; }",
+	}
+
+	for _, source := range valid {
+		if diags := CheckSource(source); len(diags.Diagnostics) != 0 {
+			t.Fatalf("expected %q to be valid, got %v", source, diags.Diagnostics)
+		}
+	}
+
+	invalid := map[string]string{
+		"proc main(n: int) :: int { escape 0; }":              "main has the wrong signature",
+		"proc main(args: string[]) :: void { }":               "main has the wrong signature",
+		"struct main { x: int, }":                             "main must be a procedure",
+		"proc helper() :: int { escape 0; }":                  " has no main procedure",
+		"proc main(a: string[], b: int) :: int { escape 0; }": "main has the wrong signature",
+	}
+
+	for source, message := range invalid {
+		diags := CheckSource(source)
+
+		if len(diags.Diagnostics) != 1 || !strings.HasSuffix(diags.Diagnostics[0].Message, message) {
+			t.Fatalf("expected %q to report %q, got %v", source, message, diags.Diagnostics)
+		}
+	}
+}
+
+func TestCheckNames(t *testing.T) {
+	diags := CheckSource(`
+proc main() :: int {
+	let count: int = 1;
+	let count: int = 2;
+
+	if true {
+		let count: int = 3;
+	}
+
+	printf("%d\n", cuont);
+	missing();
+	escape count;
+}`)
+
+	expected := []string{
+		"count is already declared in this scope",
+		"count shadows the variable count",
+		"cannot find cuont in this scope",
+		"cannot find missing in this scope",
+	}
+
+	if len(diags.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Diagnostics)
+	}
+
+	for i, message := range expected {
+		if diags.Diagnostics[i].Message != message {
+			t.Fatalf("expected %q, got %q", message, diags.Diagnostics[i].Message)
+		}
+	}
+
+	if fixes := diags.Diagnostics[2].Fixes; len(fixes) != 1 || fixes[0].Replacement != "count" {
+		t.Fatalf("expected a fix suggesting count, got %v", fixes)
+	}
+}
+
+func TestCheckArrays(t *testing.T) {
+	diags := CheckSource(`
+proc first(values: int[]) :: int {
+	escape values[0];
+}
+
+proc names() :: string[] {
+	escape ["a", "b"];
+}
+
+proc main() :: int {
+	let values = [1, 2, 3];
+	let n: int = len(values) + len(names()) + len("abc") + first(values);
+	let empty: int[] = [];
+	first([]);
+
+	len(5);
+	len(values, values);
+	first(names());
+	escape n;
+}`)
+
+	expected := []string{
+		"cannot take the length of a value of type int",
+		"len takes 1 argument, got 2",
+		"mismatched types: expected int[], got string[]",
+	}
+
+	if len(diags.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Diagnostics)
+	}
+
+	for i, message := range expected {
+		if diags.Diagnostics[i].Message != message {
+			t.Fatalf("expected %q, got %q", message, diags.Diagnostics[i].Message)
+		}
+	}
+}
+
+func TestCheckIteration(t *testing.T) {
+	diags := CheckSource(`
+proc main() :: int {
+	let words = ["a", "b"];
+	let r = 0:len(words);
+
+	iter i, word in words {
+		let w: string = word;
+		let n: int = i;
+	}
+
+	iter c in "abc" {
+		let x: char = c;
+	}
+
+	iter n in r {
+		let x: int = n;
+	}
+
+	iter x in 3 {}
+	iter c in "abc" {
+		let s: string = c;
+	}
+
+	escape 0;
+}`)
+
+	expected := []string{
+		"cannot iterate over a value of type int",
+		"mismatched types: expected string, got char",
+	}
+
+	if len(diags.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Diagnostics)
+	}
+
+	for i, message := range expected {
+		if diags.Diagnostics[i].Message != message {
+			t.Fatalf("expected %q, got %q", message, diags.Diagnostics[i].Message)
+		}
+	}
+}
+
+func TestCheckRangeSteps(t *testing.T) {
+	diags := CheckSource(`
+proc main() :: int {
+	let step = 2;
+
+	iter i in 10:0 step -step {}
+	iter i in 0..=10 step 0 {}
+	iter i in 0:10 step -0 {}
+	iter i in 0:10 step true {}
+
+	escape 0;
+}`)
+
+	expected := []string{
+		"the step of a range cannot be 0",
+		"the step of a range cannot be 0",
+		"mismatched types: expected int, got bool",
+	}
+
+	if len(diags.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Diagnostics)
+	}
+
+	for i, message := range expected {
+		if diags.Diagnostics[i].Message != message {
+			t.Fatalf("expected %q, got %q", message, diags.Diagnostics[i].Message)
+		}
+	}
+}
+
+func TestCheckRangeValues(t *testing.T) {
+	diags := CheckSource(`
+struct Window {
+	rows: range,
+}
+
+proc evens(upper: int) :: range {
+	escape 0:upper step 2;
+}
+
+proc main() :: int {
+	let w = Window { rows: evens(10), };
+	let r: range = w.rows;
+
+	iter i in r {}
+
+	let n: int = evens(4);
+
+	escape 0;
+}`)
+
+	expected := []string{
+		"mismatched types: expected int, got range",
+	}
+
+	if len(diags.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Diagnostics)
+	}
+
+	for i, message := range expected {
+		if diags.Diagnostics[i].Message != message {
+			t.Fatalf("expected %q, got %q", message, diags.Diagnostics[i].Message)
+		}
+	}
+}
+
+func TestCheckEnums(t *testing.T) {
+	diags := CheckSource(`
+enum Shape {
+	Circle(radius: int),
+	Rect(w: int, h: int),
+	Empty,
+}
+
+proc area(s: Shape) :: int {
+	escape match s {
+		Shape::Circle(r) => 3 * r * r,
+		Shape::Rect(w, h) => w * h,
+		Shape::Empty => 0,
+	};
+}
+
+proc main() :: int {
+	let shapes = [Shape::Circle(1), Shape::Rect(2, 3), Shape::Empty];
+
+	match shapes[0] {
+		Shape::Circle(r) => {
+			let radius: int = r;
+		}
+		Shape::Rect => {}
+	}
+
+	match shapes[1] {
+		Shape::Circle => {}
+		Shape::Circle => {}
+		_ => {}
+	}
+
+	let s = Shape::Circle;
+	let t = Shape::Rect(1, "2");
+
+	match 1 {
+		_ => {}
+	}
+
+	escape area(shapes[0]);
+}`)
+
+	expected := []string{
+		"match is not exhaustive, Shape::Empty is not matched",
+		"this arm is unreachable, Shape::Circle is already matched",
+		"Circle has fields, which have to be given like Circle(...)",
+		"mismatched types: expected int, got string",
+		"cannot match on a value of type int",
+	}
+
+	if len(diags.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Diagnostics)
+	}
+
+	for i, message := range expected {
+		if diags.Diagnostics[i].Message != message {
+			t.Fatalf("expected %q, got %q", message, diags.Diagnostics[i].Message)
+		}
+	}
+}
+
+func TestCheckRecursiveTypes(t *testing.T) {
+	diags := CheckSource(`
+enum List {
+	Cons(v: int, rest: List),
+	Nil,
+}
+
+struct Node {
+	next: Node,
+}
+
+struct A {
+	b: B,
+}
+
+struct B {
+	a: A,
+}
+
+enum Tree {
+	Leaf,
+	Branch(children: Vec<Tree>),
+}
+
+proc main() :: int {
+	escape 0;
+}`)
+
+	expected := []string{
+		"List contains itself, so it has no size",
+		"Node contains itself, so it has no size",
+		"A contains itself, so it has no size",
+	}
+
+	if len(diags.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Diagnostics)
+	}
+
+	for i, message := range expected {
+		if diags.Diagnostics[i].Message != message {
+			t.Fatalf("expected %q, got %q", message, diags.Diagnostics[i].Message)
+		}
+	}
+}
+
+func TestCheckMethods(t *testing.T) {
+	diags := CheckSource(`
+proc Point.add(self, other: Point) :: Point {
+	escape Point { x: self.x + other.x, };
+}
+
+proc Point.origin() :: Point {
+	escape Point { x: 0, };
+}
+
+struct Point {
+	x: int,
+}
+
+proc Point.add(self) :: int { escape 0; }
+proc Point.x(self) :: int { escape 0; }
+proc Other.f(self) :: int { escape 0; }
+proc g(self) :: int { escape 0; }
+
+proc main() :: int {
+	let p = Point.origin().add(Point { x: 1, });
+	let q: Point = Point.add(p, p);
+	let n: int = p.add(p).x;
+
+	p.origin();
+	p.ad(p);
+	p.add(1);
+	let f = p.add;
+
+	escape n;
+}`)
+
+	expected := []string{
+		"Point already has a method add",
+		"cannot find Other in this scope",
+		"Point has both a field and a method named x",
+		"self can only be the first argument of a method",
+		"origin doesn't take self, so it is called as Point.origin(...)",
+		"Point has no method ad",
+		"mismatched types: expected Point, got int",
+		"add is a method of Point, so it has to be called",
+	}
+
+	if len(diags.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Diagnostics)
+	}
+
+	for i, message := range expected {
+		if diags.Diagnostics[i].Message != message {
+			t.Fatalf("expected %q, got %q", message, diags.Diagnostics[i].Message)
+		}
+	}
+}
+
+func TestCheckReferences(t *testing.T) {
+	diags := CheckSource(`
+struct Point {
+	x: int,
+}
+
+proc Point.shift(self: &mut Point) :: void {
+	self.x = self.x + 1;
+}
+
+proc swap(a: &mut int, b: &mut int) :: void {
+	let t = *a;
+	*a = *b;
+	*b = t;
+}
+
+proc leak() :: &int {
+	let x = 1;
+	escape &x;
+}
+
+proc main() :: int {
+	let a = 1;
+	let b = 2;
+	swap(&mut a, &mut b);
+
+	let p = Point { x: 1, };
+	let m = &mut p;
+	m.shift();
+	let r: &Point = m;
+
+	r.x = 2;
+	r.shift();
+	let n = *a;
+	let s: &mut int = &a;
+	let q = &1;
+
+	escape r.x;
+}`)
+
+	expected := []string{
+		"leak cannot return a reference",
+		"cannot assign through an immutable reference",
+		"shift takes &mut self, so it can't be called through an immutable reference",
+		"cannot dereference a value of type int",
+		"mismatched types: expected &mut int, got &int",
+		"cannot take a reference to this expression",
+	}
+
+	if len(diags.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Diagnostics)
+	}
+
+	for i, message := range expected {
+		if diags.Diagnostics[i].Message != message {
+			t.Fatalf("expected %q, got %q", message, diags.Diagnostics[i].Message)
+		}
+	}
+}
+
+func TestCheckStoredReferences(t *testing.T) {
+	diags := CheckSource(`
+struct Holder {
+	r: &int,
+}
+
+enum Slot {
+	Full(r: &mut int),
+	Empty,
+}
+
+proc keep(v: &mut Vec<&int>) :: void {
+	let x = 1;
+	v.push(&x);
+}
+
+proc leak() :: Vec<&int> {
+	let x = 1;
+	let r = &x;
+	escape [r];
+}
+
+proc main() :: int {
+	let x = 1;
+	let y = 2;
+	let r = &x;
+	let rr = &r;
+	let refs = [&x, &y];
+
+	if x == 1 {
+		let z = 3;
+		r = &z;
+	}
+
+	let a = [1, 2];
+	let f = &mut a[0];
+	*f = 3;
+
+	let w: Vec<int> = [1, 2];
+	let g = &mut w[0];
+	w.push(3);
+	*g = 4;
+	swap(&mut w[0], &mut w[1]);
+
+	escape *r;
+}
+
+proc swap(a: &mut int, b: &mut int) :: void {
+	let t = *a;
+	*a = *b;
+	*b = t;
+}`)
+
+	expected := []string{
+		"field r cannot hold a reference",
+		"field r cannot hold a reference",
+		"v cannot keep a reference inside a value of type Vec<&int>",
+		"leak cannot return a reference",
+		"rr cannot keep a reference inside a value of type &int",
+		"refs cannot keep a reference inside a value of type &int[]",
+		"cannot change what a reference refers to",
+		"cannot keep a reference to an element of a vector",
+	}
+
+	if len(diags.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Diagnostics)
+	}
+
+	for i, message := range expected {
+		if diags.Diagnostics[i].Message != message {
+			t.Fatalf("expected %q, got %q", message, diags.Diagnostics[i].Message)
+		}
+	}
+}
+
+func TestCheckVecs(t *testing.T) {
+	diags := CheckSource(`
+proc total(v: &Vec<int>) :: int {
+	v.push(1);
+
+	let sum = 0;
+	iter x in v {
+		sum = sum + x;
+	}
+
+	escape sum + v[0] + len(v);
+}
+
+proc main() :: int {
+	let v: Vec<int> = [];
+	v.push(1);
+	v[0] = v.pop();
+	let grid: Vec<Vec<int>> = [[1], []];
+	grid[1].push(len(grid[0]));
+
+	v.push("a");
+	v.insert(1);
+	let s: string = v.pop();
+	let a = [1];
+	a.push(2);
+
+	escape total(&v);
+}`)
+
+	expected := []string{
+		"cannot push through an immutable reference",
+		"mismatched types: expected int, got string",
+		"Vec<int> has no method insert",
+		"mismatched types: expected string, got int",
+		"int[] has no method push",
+	}
+
+	if len(diags.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Diagnostics)
+	}
+
+	for i, message := range expected {
+		if diags.Diagnostics[i].Message != message {
+			t.Fatalf("expected %q, got %q", message, diags.Diagnostics[i].Message)
+		}
+	}
+}
+
+func TestCheckSharedCopies(t *testing.T) {
+	diags := CheckSource(`
+struct Bag {
+	items: Vec<int>,
+}
+
+proc peek(v: &Vec<int>, b: &Bag, grid: &Vec<Vec<int>>) :: int {
+	let n = len(*v) + (*v)[0] + b.items[0] + len(b.items);
+	iter x in v {}
+
+	let w = *v;
+	w.push(3);
+	let items = b.items;
+	iter row in grid {}
+
+	escape n;
+}
+
+proc change(v: &mut Vec<int>) :: void {
+	let w = *v;
+	w.push(3);
+}
+
+proc main() :: int {
+	escape 0;
+}`)
+
+	expected := []string{
+		"cannot copy a value of type Vec<int> out of an immutable reference",
+		"cannot copy a value of type Vec<int> out of an immutable reference",
+		"cannot copy a value of type Vec<int> out of an immutable reference",
+	}
+
+	if len(diags.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Diagnostics)
+	}
+
+	for i, message := range expected {
+		if diags.Diagnostics[i].Message != message {
+			t.Fatalf("expected %q, got %q", message, diags.Diagnostics[i].Message)
+		}
+	}
+}
+
+func TestCheckMaps(t *testing.T) {
+	diags := CheckSource(`
+proc lookup(m: &map<Key, string>) :: string {
+	m.remove(Key { a: 1, });
+	escape m.get(Key { a: 1, });
+}
+
+struct Key {
+	a: int,
+}
+
+struct Holder {
+	values: int[],
+}
+
+proc main() :: int {
+	let counts = {"a": 1};
+	counts.insert("b", 2);
+
+	iter word, n in counts {
+		let w: string = word;
+		let m: int = n;
+	}
+
+	let keys: map<Key, string> = {};
+	let holders: map<Holder, int> = {};
+	let e = {};
+	counts.insert(1, 2);
+	let s: string = counts.get("a");
+
+	escape len(counts) + len(lookup(&keys));
+}`)
+
+	expected := []string{
+		"cannot remove through an immutable reference",
+		"cannot use values of type Holder as map keys",
+		"cannot infer the type of e from an empty map",
+		"mismatched types: expected string, got int",
+		"mismatched types: expected string, got int",
+	}
+
+	if len(diags.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Diagnostics)
+	}
+
+	for i, message := range expected {
+		if diags.Diagnostics[i].Message != message {
+			t.Fatalf("expected %q, got %q", message, diags.Diagnostics[i].Message)
+		}
+	}
+}
+
+func TestCheckStrings(t *testing.T) {
+	diags := CheckSource(`
+proc main() :: int {
+	let s = "whirl" + "!";
+	let same: bool = s == "whirl!";
+	let before: bool = s < "x";
+	let c: char = s[0];
+	let sub: string = s[1:3];
+	let n: int = parse_int(to_string(len(s))) + len(to_string(c));
+
+	s[0:2] = "ab";
+	let r = &s[0];
+	let bad = s + 1;
+	let step = s[0:4 step 2];
+	let b = to_string(same);
+
+	escape n;
+}`)
+
+	expected := []string{
+		"cannot assign to a slice of a string",
+		"cannot take a reference to a character of a string",
+		"cannot apply + to string and int",
+		"a string cannot be sliced with a step",
+		"cannot convert a value of type bool to a string",
+	}
+
+	if len(diags.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Diagnostics)
+	}
+
+	for i, message := range expected {
+		if diags.Diagnostics[i].Message != message {
+			t.Fatalf("expected %q, got %q", message, diags.Diagnostics[i].Message)
+		}
+	}
+}
+
+func TestCheckNumbers(t *testing.T) {
+	diags := CheckSource(`
+proc scale(x: f64, by: f32) :: f64 {
+	escape x * (by as f64);
+}
+
+proc main() :: int {
+	let big: i64 = 9000000000;
+	let byte: u8 = 255;
+	let f: float = 1;
+	let g = scale(2.5, 2) + f;
+	let h: f32 = -1.5;
+	let n: int = (g as int) + ('a' as int) + (true as int) + byte as int;
+	let sum = big + 1;
+	let small: i8 = -128;
+	let most: u64 = 18446744073709551615;
+	let least: i64 = -9223372036854775808;
+
+	let over: u8 = 256;
+	let under: u8 = -1;
+	let wide = 3000000000;
+	let mixed = big + n;
+	let rest = g % 2.0;
+	let truncated: int = 2.5;
+	let s = "1" as int;
+	let c = 1.5 as char;
+
+	escape n;
+}`)
+
+	expected := []string{
+		"256 does not fit in u8",
+		"-1 does not fit in u8",
+		"3000000000 does not fit in int",
+		"cannot apply + to i64 and int",
+		"cannot apply % to f64 and float",
+		"mismatched types: expected int, got float",
+		"cannot convert a value of type string to int",
+		"cannot convert a value of type float to char",
+	}
+
+	if len(diags.Diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags.Diagnostics)
+	}
+
+	for i, message := range expected {
+		if diags.Diagnostics[i].Message != message {
+			t.Fatalf("expected %q, got %q", message, diags.Diagnostics[i].Message)
+		}
+	}
+}
+
+func CheckSource(input string) *diagnostic.Collector {
+	diags := diagnostic.NewCollector()
+	module := codegen.Module{
+		Name:         "main",
+		Instructions: parser.Parse(lexer.Iterator([]byte(input)), diags),
+		Imports:      map[string]*codegen.Module{},
+	}
+
+	Check(&module, diags)
+
+	return diags
+}
@@ -0,0 +1,997 @@
+package check
+
+import (
+	"github.com/whirl-lang/whirl/pkg/codegen"
+	"github.com/whirl-lang/whirl/pkg/diagnostic"
+	"github.com/whirl-lang/whirl/pkg/lexer"
+)
+
+// Expr returns the type of an expression along with the expression rewritten
+// for codegen, with the types it needs filled in and builtins lowered.
+// expected is the type the context wants, if it knows, and is used to type
+// empty array literals.
+func (c *Checker) Expr(expr codegen.Expr, expected codegen.Type) (codegen.Expr, codegen.Type) {
+	switch e := expr.(type) {
+	case codegen.Literal:
+		return e, typeOf(e.Value)
+	case codegen.Ident:
+		return c.Value(codegen.Path{Tokens: []codegen.Ident{e}, Span: e.Span}, e)
+	case codegen.Path:
+		return c.Value(e, e)
+	case codegen.Binary:
+		return c.Binary(e)
+	case codegen.Unary:
+		return c.Unary(e)
+	case codegen.Cast:
+		return c.Cast(e)
+	case codegen.AddressOf:
+		return c.AddressOf(e)
+	case codegen.Deref:
+		return c.copied(e)
+	case codegen.Call:
+		return c.Call(e)
+	case codegen.Index:
+		if isPlace(e) {
+			return c.copied(e)
+		}
+
+		return c.Index(e)
+	case codegen.FieldAccess:
+		if isPlace(e) {
+			return c.copied(e)
+		}
+
+		return c.FieldAccess(e)
+	case codegen.Array:
+		return c.Array(e, expected)
+	case codegen.Map:
+		return c.Map(e, expected)
+	case codegen.StructInit:
+		return c.StructInit(e)
+	case codegen.Range:
+		return c.Range(e)
+	case codegen.Match:
+		return c.Match(e, true)
+	}
+
+	return expr, unknown{}
+}
+
+// Typed checks an expression that must be of type expected and returns it
+// rewritten.
+func (c *Checker) Typed(expr codegen.Expr, expected codegen.Type) codegen.Expr {
+	expr, typ := c.Expr(expr, expected)
+	c.expect(expr, expected, typ)
+
+	return expr
+}
+
+// Value returns the type of the variable or variant without fields a path
+// refers to, along with expr, the path, rewritten.
+func (c *Checker) Value(path codegen.Path, expr codegen.Expr) (codegen.Expr, codegen.Type) {
+	symbol := c.Lookup(path)
+
+	if symbol == nil {
+		return expr, unknown{}
+	}
+
+	switch symbol.Kind {
+	case Variable:
+		return expr, symbol.Type
+	case Variant:
+		if len(symbol.Fields) > 0 {
+			c.errorf(path, "%s has fields, which have to be given like %s(...)", symbol.Name, symbol.Name)
+
+			return expr, unknown{}
+		}
+
+		return codegen.VariantInit{Type: symbol.Type, Variant: path.Tokens[len(path.Tokens)-1], Tag: symbol.Tag, Span: path.Span}, symbol.Type
+	}
+
+	c.errorf(path, "%s is a %s, not a value", symbol.Name, symbol.Kind)
+
+	return expr, unknown{}
+}
+
+func (c *Checker) Binary(b codegen.Binary) (codegen.Expr, codegen.Type) {
+	var left, right codegen.Type
+
+	b.Left, left = c.Expr(b.Left, nil)
+	b.Right, right = c.Expr(b.Right, nil)
+	op := lexer.TokensPretty[b.Op]
+
+	// operators on strings are lowered to the runtime
+	strings := areStrings(left, right)
+
+	switch b.Op {
+	case lexer.PLUS, lexer.MINUS, lexer.MUL, lexer.DIV, lexer.MOD:
+		if strings && b.Op == lexer.PLUS {
+			return codegen.RuntimeCall{Name: "__whirl_string_concat", Args: []codegen.Expr{b.Left, b.Right}, Position: true, Span: b.Span}, codegen.String{}
+		}
+
+		return b, c.arithmetic(b, left, right)
+	case lexer.LT, lexer.GT, lexer.LE, lexer.GE:
+		if strings {
+			b.Left = codegen.RuntimeCall{Name: "__whirl_string_cmp", Args: []codegen.Expr{b.Left, b.Right}, Span: b.Span}
+			b.Right = codegen.Literal{Value: codegen.Int{Value: 0}, Span: b.Span}
+		} else {
+			c.arithmetic(b, left, right)
+		}
+	case lexer.EQ, lexer.NE:
+		if isNumber(left) && isNumber(right) {
+			c.arithmetic(b, left, right)
+		} else if !Equal(left, right) {
+			c.errorf(b, "cannot compare %s with %s", Name(left), Name(right))
+		} else if !isComparable(left) {
+			c.errorf(b, "cannot compare values of type %s with %s", Name(left), op)
+		} else if strings {
+			var equal codegen.Expr = codegen.RuntimeCall{Name: "__whirl_string_eq", Args: []codegen.Expr{b.Left, b.Right}, Span: b.Span}
+
+			if b.Op == lexer.NE {
+				equal = codegen.Unary{Op: lexer.NOT, Expr: equal, Span: b.Span}
+			}
+
+			return equal, codegen.Bool{}
+		}
+	case lexer.AND, lexer.OR:
+		c.expect(b.Left, codegen.Bool{}, left)
+		c.expect(b.Right, codegen.Bool{}, right)
+	}
+
+	return b, codegen.Bool{}
+}
+
+func (c *Checker) Unary(u codegen.Unary) (codegen.Expr, codegen.Type) {
+	var typ codegen.Type
+
+	u.Expr, typ = c.Expr(u.Expr, nil)
+
+	if u.Op == lexer.NOT {
+		c.expect(u.Expr, codegen.Bool{}, typ)
+
+		return u, codegen.Bool{}
+	}
+
+	if !isNumeric(typ) {
+		c.errorf(u, "cannot apply %s to %s", lexer.TokensPretty[u.Op], Name(typ))
+
+		return u, unknown{}
+	}
+
+	return u, promote(typ)
+}
+
+// AddressOf checks taking a reference, which must be to something that can
+// be assigned to.
+func (c *Checker) AddressOf(address codegen.AddressOf) (codegen.Expr, codegen.Type) {
+	if !isPlace(address.Expr) {
+		c.errorf(address.Expr, "cannot take a reference to this expression")
+		c.Expr(address.Expr, nil)
+
+		return address, unknown{}
+	}
+
+	expr, typ, mutable := c.place(address.Expr)
+	address.Expr = expr
+
+	if part := stringPart(expr); part != "" {
+		c.errorf(address, "cannot take a reference to %s", part)
+
+		return address, unknown{}
+	}
+
+	if address.Mutable && !mutable {
+		c.errorf(address, "cannot take a mutable reference through an immutable reference")
+	}
+
+	return address, codegen.Reference{Type: typ, Mutable: address.Mutable}
+}
+
+// referred checks a dereference and returns it with the type of the value
+// the reference refers to and whether that can be changed.
+func (c *Checker) referred(deref codegen.Deref) (codegen.Expr, codegen.Type, bool) {
+	var typ codegen.Type
+
+	deref.Expr, typ = c.Expr(deref.Expr, nil)
+	reference, ok := typ.(codegen.Reference)
+
+	if !ok {
+		if !isUnknown(typ) {
+			c.errorf(deref.Expr, "cannot dereference a value of type %s", Name(typ))
+		}
+
+		return deref, unknown{}, true
+	}
+
+	return deref, reference.Type, reference.Mutable
+}
+
+func (c *Checker) Call(call codegen.Call) (codegen.Expr, codegen.Type) {
+	var path codegen.Path
+
+	switch callee := call.Callee.(type) {
+	case codegen.Ident:
+		path = codegen.Path{Tokens: []codegen.Ident{callee}, Span: callee.Span}
+	case codegen.Path:
+		path = callee
+	case codegen.FieldAccess:
+		return c.MethodCall(call, callee)
+	default:
+		c.errorf(callee, "only procedures can be called")
+		c.args(call.Args)
+
+		return call, unknown{}
+	}
+
+	symbol := c.Lookup(path)
+
+	if symbol == nil {
+		c.args(call.Args)
+
+		return call, unknown{}
+	}
+
+	switch symbol.Kind {
+	case Builtin:
+		return c.Builtin(symbol, call)
+	case Procedure, Variant:
+	default:
+		c.errorf(path, "%s is a %s, not a procedure", symbol.Name, symbol.Kind)
+		c.args(call.Args)
+
+		return call, unknown{}
+	}
+
+	c.arguments(call, symbol.Name, symbol.Args)
+
+	if symbol.Kind == Variant {
+		return codegen.VariantInit{Type: symbol.Type, Variant: path.Tokens[len(path.Tokens)-1], Tag: symbol.Tag, Args: call.Args, Span: call.Span}, symbol.Type
+	}
+
+	return call, symbol.Type
+}
+
+// MethodCall checks a call of a method, either on a value as value.method(...)
+// or on its struct as Struct.method(...). It is lowered to a call with the
+// value as the first argument.
+func (c *Checker) MethodCall(call codegen.Call, access codegen.FieldAccess) (codegen.Expr, codegen.Type) {
+	switch receiver := access.Expr.(type) {
+	case codegen.Ident:
+		if symbol := c.scope.Lookup(receiver.Name); symbol != nil && symbol.Kind == Struct {
+			return c.StaticCall(call, access, symbol)
+		}
+	case codegen.Path:
+		symbol := c.Lookup(receiver)
+
+		if symbol == nil {
+			c.args(call.Args)
+
+			return call, unknown{}
+		}
+
+		if symbol.Kind == Struct {
+			return c.StaticCall(call, access, symbol)
+		}
+	}
+
+	var receiver codegen.Expr
+	var typ codegen.Type
+
+	// a reference to self can only be taken to a place
+	addressable, mutable := isPlace(access.Expr), false
+
+	if addressable {
+		receiver, typ, mutable = c.place(access.Expr)
+	} else {
+		receiver, typ = c.Expr(access.Expr, nil)
+	}
+
+	if reference, ok := typ.(codegen.Reference); ok {
+		receiver, typ = through(receiver, typ)
+		addressable, mutable = true, reference.Mutable
+	}
+
+	// vectors and maps are changed through copies, unless they are behind
+	// an immutable reference
+	switch t := typ.(type) {
+	case codegen.Vec:
+		return c.VecMethod(call, access, receiver, t, mutable || !addressable)
+	case codegen.Map:
+		return c.MapMethod(call, access, receiver, t, mutable || !addressable)
+	}
+
+	structure, ok := typ.(structType)
+
+	if !ok {
+		if !isUnknown(typ) {
+			c.errorf(access.Field, "%s has no method %s", Name(typ), access.Field.Name)
+		}
+
+		c.args(call.Args)
+
+		return call, unknown{}
+	}
+
+	method := c.findMethod(structure.Symbol, access.Field)
+
+	if method == nil {
+		c.args(call.Args)
+
+		return call, unknown{}
+	}
+
+	if !method.Self {
+		c.errorf(access.Field, "%s doesn't take self, so it is called as %s.%s(...)", method.Name, structure.Symbol.Name, method.Name)
+		c.args(call.Args)
+
+		return call, unknown{}
+	}
+
+	if self, ok := method.Args[0].(codegen.Reference); ok {
+		switch {
+		case !addressable:
+			c.errorf(access.Expr, "%s takes a reference to self, so it can't be called on a temporary value", method.Name)
+		case self.Mutable && !mutable:
+			c.errorf(access.Expr, "%s takes &mut self, so it can't be called through an immutable reference", method.Name)
+		}
+
+		receiver = codegen.AddressOf{Expr: receiver, Mutable: self.Mutable, Span: codegen.SpanOf(receiver)}
+	} else if addressable {
+		c.copyOut(access.Expr, typ, mutable)
+	}
+
+	c.arguments(call, method.Name, method.Args[1:])
+	call.Callee = codegen.Method{Namespace: structure.Symbol.Module.Namespace, Receiver: structure.Symbol.Name, Ident: access.Field, Span: access.Span}
+	call.Args = append([]codegen.Expr{receiver}, call.Args...)
+
+	return call, method.Type
+}
+
+// VecMethod checks a call of a method of a vector, push or pop, which are
+// lowered to the operations of its runtime.
+func (c *Checker) VecMethod(call codegen.Call, access codegen.FieldAccess, receiver codegen.Expr, vec codegen.Vec, mutable bool) (codegen.Expr, codegen.Type) {
+	var args []codegen.Type
+	var result codegen.Type
+
+	switch access.Field.Name {
+	case "push":
+		args = []codegen.Type{vec.Type}
+		result = codegen.Void{}
+	case "pop":
+		result = vec.Type
+	default:
+		c.errorf(access.Field, "%s has no method %s", Name(vec), access.Field.Name)
+		c.args(call.Args)
+
+		return call, unknown{}
+	}
+
+	if !mutable {
+		c.errorf(access.Expr, "cannot %s through an immutable reference", access.Field.Name)
+	}
+
+	c.arguments(call, access.Field.Name, args)
+
+	return codegen.VecCall{Vec: vec, Name: access.Field.Name, Args: append([]codegen.Expr{receiver}, call.Args...), Span: call.Span}, result
+}
+
+// MapMethod checks a call of a method of a map, which are lowered to the
+// operations of its runtime.
+func (c *Checker) MapMethod(call codegen.Call, access codegen.FieldAccess, receiver codegen.Expr, m codegen.Map, mutable bool) (codegen.Expr, codegen.Type) {
+	var args []codegen.Type
+	var result codegen.Type
+
+	switch access.Field.Name {
+	case "insert":
+		args = []codegen.Type{m.Key, m.Value}
+		result = codegen.Void{}
+	case "get":
+		args = []codegen.Type{m.Key}
+		result = m.Value
+	case "contains":
+		args = []codegen.Type{m.Key}
+		result = codegen.Bool{}
+	case "remove":
+		args = []codegen.Type{m.Key}
+		result = codegen.Bool{}
+	default:
+		c.errorf(access.Field, "%s has no method %s", Name(m), access.Field.Name)
+		c.args(call.Args)
+
+		return call, unknown{}
+	}
+
+	changes := access.Field.Name == "insert" || access.Field.Name == "remove"
+
+	if changes && !mutable {
+		c.errorf(access.Expr, "cannot %s through an immutable reference", access.Field.Name)
+	}
+
+	c.arguments(call, access.Field.Name, args)
+
+	return codegen.MapCall{Map: m, Name: access.Field.Name, Args: append([]codegen.Expr{receiver}, call.Args...), Span: call.Span}, result
+}
+
+// StaticCall checks a call of a method on its struct, which passes every
+// argument, including self, explicitly.
+func (c *Checker) StaticCall(call codegen.Call, access codegen.FieldAccess, structure *Symbol) (codegen.Expr, codegen.Type) {
+	method := c.findMethod(structure, access.Field)
+
+	if method == nil {
+		c.args(call.Args)
+
+		return call, unknown{}
+	}
+
+	c.arguments(call, method.Name, method.Args)
+	call.Callee = codegen.Method{Namespace: structure.Module.Namespace, Receiver: structure.Name, Ident: access.Field, Span: access.Span}
+
+	return call, method.Type
+}
+
+// findMethod returns the method of a struct with the given name, reporting an
+// error if there is none.
+func (c *Checker) findMethod(structure *Symbol, ident codegen.Ident) *Symbol {
+	if method := structure.Methods.Symbols[ident.Name]; method != nil {
+		return method
+	}
+
+	for _, field := range structure.Fields {
+		if field.Ident.Name == ident.Name {
+			c.errorf(ident, "%s is a field of %s, not a method", ident.Name, structure.Name)
+
+			return nil
+		}
+	}
+
+	err := diagnostic.Errorf(ident.Span, "%s has no method %s", structure.Name, ident.Name)
+
+	if similar := structure.Methods.Similar(ident.Name, false); similar != "" {
+		err = err.WithFix(ident.Span, similar, "a method with a similar name exists")
+	}
+
+	c.Diagnostics.Report(err)
+
+	return nil
+}
+
+// arguments checks the arguments of a call against the argument types of
+// what it calls.
+func (c *Checker) arguments(call codegen.Call, name string, types []codegen.Type) {
+	if len(call.Args) != len(types) {
+		c.errorf(call, "%s takes %d arguments, got %d", name, len(types), len(call.Args))
+	}
+
+	for i, arg := range call.Args {
+		if i >= len(types) {
+			call.Args[i], _ = c.Expr(arg, nil)
+
+			continue
+		}
+
+		call.Args[i] = c.Typed(arg, types[i])
+	}
+}
+
+// Builtin checks a call to a builtin procedure and lowers it for codegen.
+func (c *Checker) Builtin(symbol *Symbol, call codegen.Call) (codegen.Expr, codegen.Type) {
+	switch symbol.Name {
+	case "len":
+		return c.Len(call)
+	case "to_string":
+		return c.ToString(call)
+	case "parse_int":
+		return c.ParseInt(call)
+	}
+
+	return c.Printf(call)
+}
+
+// Printf checks a call to the C printf, which takes a format string followed
+// by values of any type.
+func (c *Checker) Printf(call codegen.Call) (codegen.Expr, codegen.Type) {
+	if len(call.Args) == 0 {
+		c.errorf(call, "printf takes a format string")
+
+		return call, codegen.Int{}
+	}
+
+	call.Args[0] = codegen.CString{Expr: c.Typed(call.Args[0], codegen.String{}), Span: codegen.SpanOf(call.Args[0])}
+
+	for i, arg := range call.Args[1:] {
+		arg, typ := c.Expr(arg, nil)
+
+		// strings are passed for %s
+		if _, ok := typ.(codegen.String); ok {
+			arg = codegen.CString{Expr: arg, Span: codegen.SpanOf(arg)}
+		}
+
+		call.Args[i+1] = arg
+	}
+
+	return call, codegen.Int{}
+}
+
+// ToString checks a call to to_string, which converts a number or a char to
+// a string.
+func (c *Checker) ToString(call codegen.Call) (codegen.Expr, codegen.Type) {
+	if len(call.Args) != 1 {
+		c.errorf(call, "to_string takes 1 argument, got %d", len(call.Args))
+		c.args(call.Args)
+
+		return call, codegen.String{}
+	}
+
+	arg, typ := c.Expr(call.Args[0], nil)
+	name := "__whirl_string_from_int"
+
+	switch typ := typ.(type) {
+	case codegen.Int:
+		if typ.Unsigned {
+			name = "__whirl_string_from_uint"
+		}
+	case codegen.Float:
+		name = "__whirl_string_from_float"
+	case unknown:
+	case codegen.Char:
+		name = "__whirl_string_from_char"
+	default:
+		c.errorf(arg, "cannot convert a value of type %s to a string", Name(typ))
+	}
+
+	return codegen.RuntimeCall{Name: name, Args: []codegen.Expr{arg}, Position: true, Span: call.Span}, codegen.String{}
+}
+
+// ParseInt checks a call to parse_int, which converts a string of decimal
+// digits to an int, stopping the program if it isn't one.
+func (c *Checker) ParseInt(call codegen.Call) (codegen.Expr, codegen.Type) {
+	c.arguments(call, "parse_int", []codegen.Type{codegen.String{}})
+
+	return codegen.RuntimeCall{Name: "__whirl_string_to_int", Args: call.Args, Position: true, Span: call.Span}, codegen.Int{}
+}
+
+// Len checks a call to len, which returns the length of an array or string.
+func (c *Checker) Len(call codegen.Call) (codegen.Expr, codegen.Type) {
+	if len(call.Args) != 1 {
+		c.errorf(call, "len takes 1 argument, got %d", len(call.Args))
+		c.args(call.Args)
+
+		return call, codegen.Int{}
+	}
+
+	arg, typ, _ := c.operand(call.Args[0])
+
+	switch typ.(type) {
+	case codegen.Array:
+		return codegen.FieldAccess{Expr: arg, Field: codegen.Ident{Name: "len"}, Span: call.Span}, codegen.Int{}
+	case codegen.Vec, codegen.Map:
+		collection := codegen.Deref{Expr: arg, Span: codegen.SpanOf(arg)}
+
+		return codegen.FieldAccess{Expr: collection, Field: codegen.Ident{Name: "len"}, Span: call.Span}, codegen.Int{}
+	case codegen.String:
+		return codegen.FieldAccess{Expr: arg, Field: codegen.Ident{Name: "len"}, Span: call.Span}, codegen.Int{}
+	case unknown:
+		return call, codegen.Int{}
+	}
+
+	c.errorf(arg, "cannot take the length of a value of type %s", Name(typ))
+
+	return call, codegen.Int{}
+}
+
+// args checks arguments that can be of any type.
+func (c *Checker) args(args []codegen.Expr) {
+	for i, arg := range args {
+		args[i], _ = c.Expr(arg, nil)
+	}
+}
+
+// Target returns the type of the target of an assignment, reporting an error
+// if it isn't a place that can be changed.
+func (c *Checker) Target(target codegen.Expr) (codegen.Expr, codegen.Type) {
+	if !isPlace(target) {
+		c.errorf(target, "cannot assign to this expression")
+
+		return c.Expr(target, nil)
+	}
+
+	expr, typ, mutable := c.place(target)
+
+	if !mutable {
+		c.errorf(target, "cannot assign through an immutable reference")
+	}
+
+	// copies of a string share its characters
+	if part := stringPart(expr); part != "" {
+		c.errorf(target, "cannot assign to %s", part)
+	}
+
+	return expr, typ
+}
+
+// stringPart describes expr if it is a character or a slice of a string,
+// which isPlace accepts but which can't be changed or referenced.
+func stringPart(expr codegen.Expr) string {
+	if call, ok := expr.(codegen.RuntimeCall); ok {
+		switch call.Name {
+		case "__whirl_string_at":
+			return "a character of a string"
+		case "__whirl_string_slice":
+			return "a slice of a string"
+		}
+	}
+
+	return ""
+}
+
+// isPlace reports whether an expression refers to a variable, a field or
+// element of one or what a reference refers to, which can be assigned to and
+// referenced.
+func isPlace(expr codegen.Expr) bool {
+	switch e := expr.(type) {
+	case codegen.Ident, codegen.Deref:
+		return true
+	case codegen.FieldAccess:
+		return isPlace(e.Expr)
+	case codegen.Index:
+		return isPlace(e.Expr)
+	}
+
+	return false
+}
+
+// place checks an expression isPlace accepts and returns it rewritten, with
+// its type and whether it can be changed, which it can't through an
+// immutable reference.
+func (c *Checker) place(expr codegen.Expr) (codegen.Expr, codegen.Type, bool) {
+	switch e := expr.(type) {
+	case codegen.FieldAccess:
+		inner, typ, mutable := c.place(e.Expr)
+
+		if reference, ok := typ.(codegen.Reference); ok {
+			mutable = reference.Mutable
+		}
+
+		e.Expr, typ = through(inner, typ)
+
+		return e, c.field(typ, e), mutable
+	case codegen.Index:
+		inner, typ, mutable := c.place(e.Expr)
+
+		if reference, ok := typ.(codegen.Reference); ok {
+			mutable = reference.Mutable
+		}
+
+		e.Expr, typ = through(inner, typ)
+		expr, typ := c.element(typ, e)
+
+		return expr, typ, mutable
+	case codegen.Deref:
+		return c.referred(e)
+	}
+
+	expr, typ := c.Expr(expr, nil)
+
+	return expr, typ, true
+}
+
+// copied checks a place whose value is copied, like into a variable or an
+// argument.
+func (c *Checker) copied(expr codegen.Expr) (codegen.Expr, codegen.Type) {
+	expr, typ, mutable := c.place(expr)
+	c.copyOut(expr, typ, mutable)
+
+	return expr, typ
+}
+
+// copyOut reports a copy of a value that can't be changed if the copy shares
+// elements with it, as they could be changed through the copy.
+func (c *Checker) copyOut(node interface{}, typ codegen.Type, mutable bool) {
+	if !mutable && shares(typ) {
+		c.Diagnostics.Report(diagnostic.Errorf(codegen.SpanOf(node), "cannot copy a value of type %s out of an immutable reference", Name(typ)).
+			WithNote("copies of arrays, vectors and maps share their elements, which could be changed through the copy"))
+	}
+}
+
+// operand checks an expression that is looked into without being copied,
+// like what is iterated over. It returns the expression through a
+// reference, with its type and whether it can be changed.
+func (c *Checker) operand(expr codegen.Expr) (codegen.Expr, codegen.Type, bool) {
+	var typ codegen.Type
+	mutable := true
+
+	if isPlace(expr) {
+		expr, typ, mutable = c.place(expr)
+	} else {
+		expr, typ = c.Expr(expr, nil)
+	}
+
+	if reference, ok := typ.(codegen.Reference); ok {
+		mutable = reference.Mutable
+	}
+
+	expr, typ = through(expr, typ)
+
+	return expr, typ, mutable
+}
+
+func (c *Checker) Index(index codegen.Index) (codegen.Expr, codegen.Type) {
+	var typ codegen.Type
+
+	index.Expr, typ = through(c.Expr(index.Expr, nil))
+
+	return c.element(typ, index)
+}
+
+// element returns the type of the elements of typ, which is indexed into,
+// and the index with its array type filled in.
+func (c *Checker) element(typ codegen.Type, index codegen.Index) (codegen.Expr, codegen.Type) {
+	if r, ok := index.Index.(codegen.Range); ok {
+		return c.slice(typ, index, r)
+	}
+
+	index.Index = c.Typed(index.Index, codegen.Int{})
+
+	switch t := typ.(type) {
+	case codegen.Array:
+		index.Array = &t
+
+		return index, t.Type
+	case codegen.Vec:
+		index.Vec = &t
+
+		return index, t.Type
+	case codegen.String:
+		return codegen.RuntimeCall{Name: "__whirl_string_at", Args: []codegen.Expr{index.Expr, index.Index}, Position: true, Span: index.Span}, codegen.Char{}
+	case unknown:
+		return index, unknown{}
+	}
+
+	c.errorf(index.Expr, "cannot index into a value of type %s", Name(typ))
+
+	return index, unknown{}
+}
+
+// slice checks indexing into a string with a range, which copies the
+// characters in the range to a new string.
+func (c *Checker) slice(typ codegen.Type, index codegen.Index, r codegen.Range) (codegen.Expr, codegen.Type) {
+	r.Lower = c.Typed(r.Lower, codegen.Int{})
+	r.Upper = c.Typed(r.Upper, codegen.Int{})
+
+	if r.Step != nil {
+		c.errorf(r.Step, "a string cannot be sliced with a step")
+		c.Expr(r.Step, nil)
+	}
+
+	switch typ.(type) {
+	case codegen.String:
+	case unknown:
+		return index, unknown{}
+	default:
+		c.errorf(index.Expr, "cannot slice a value of type %s", Name(typ))
+
+		return index, unknown{}
+	}
+
+	upper := r.Upper
+
+	if r.Inclusive {
+		upper = codegen.Binary{Op: lexer.PLUS, Left: upper, Right: codegen.Literal{Value: codegen.Int{Value: 1}}, Span: r.Span}
+	}
+
+	return codegen.RuntimeCall{Name: "__whirl_string_slice", Args: []codegen.Expr{index.Expr, r.Lower, upper}, Position: true, Span: index.Span}, codegen.String{}
+}
+
+func (c *Checker) FieldAccess(access codegen.FieldAccess) (codegen.Expr, codegen.Type) {
+	var typ codegen.Type
+
+	access.Expr, typ = through(c.Expr(access.Expr, nil))
+
+	return access, c.field(typ, access)
+}
+
+// field returns the type of the accessed field of a value of type typ.
+func (c *Checker) field(typ codegen.Type, access codegen.FieldAccess) codegen.Type {
+	if isUnknown(typ) {
+		return unknown{}
+	}
+
+	structure, ok := typ.(structType)
+
+	if !ok {
+		c.errorf(access.Field, "%s has no field %s", Name(typ), access.Field.Name)
+
+		return unknown{}
+	}
+
+	for _, field := range structure.Symbol.Fields {
+		if field.Ident.Name == access.Field.Name {
+			return field.Type
+		}
+	}
+
+	if structure.Symbol.Methods.Symbols[access.Field.Name] != nil {
+		c.errorf(access.Field, "%s is a method of %s, so it has to be called", access.Field.Name, Name(typ))
+
+		return unknown{}
+	}
+
+	c.errorf(access.Field, "%s has no field %s", Name(typ), access.Field.Name)
+
+	return unknown{}
+}
+
+// Map checks a map literal, whose types are those of its first entry unless
+// the context expects a map.
+func (c *Checker) Map(m codegen.Map, expected codegen.Type) (codegen.Expr, codegen.Type) {
+	var key, value codegen.Type = unknown{}, unknown{}
+	hint, hinted := expected.(codegen.Map)
+
+	if hinted {
+		key, value = hint.Key, hint.Value
+	}
+
+	if len(m.Keys) == 0 && !hinted {
+		c.errorf(m, "cannot infer the type of an empty map")
+
+		return m, unknown{}
+	}
+
+	for i := range m.Keys {
+		var k, v codegen.Type
+
+		m.Keys[i], k = c.Expr(m.Keys[i], key)
+		m.Values[i], v = c.Expr(m.Values[i], value)
+
+		if i == 0 && !hinted {
+			key, value = k, v
+			c.key(codegen.Map{Key: key, Value: value, Span: m.Span})
+
+			continue
+		}
+
+		c.expect(m.Keys[i], key, k)
+		c.expect(m.Values[i], value, v)
+	}
+
+	m.Key, m.Value = key, value
+
+	return m, codegen.Map{Key: key, Value: value}
+}
+
+func (c *Checker) Array(array codegen.Array, expected codegen.Type) (codegen.Expr, codegen.Type) {
+	var element codegen.Type = unknown{}
+	hinted := false
+	vec, isVec := expected.(codegen.Vec)
+
+	switch expected := expected.(type) {
+	case codegen.Array:
+		element = expected.Type
+		hinted = true
+	case codegen.Vec:
+		element = expected.Type
+		hinted = true
+	}
+
+	if len(array.Value) == 0 && !hinted {
+		c.errorf(array, "cannot infer the type of an empty array")
+
+		return array, unknown{}
+	}
+
+	for i, value := range array.Value {
+		value, typ := c.Expr(value, element)
+		array.Value[i] = value
+
+		if i == 0 && !hinted {
+			element = typ
+
+			continue
+		}
+
+		c.expect(value, element, typ)
+	}
+
+	// an array literal creates a vector where one is expected
+	if isVec {
+		vec.Value = array.Value
+		vec.Span = array.Span
+
+		return vec, codegen.Vec{Type: element}
+	}
+
+	array.Type = element
+
+	return array, codegen.Array{Type: element}
+}
+
+func (c *Checker) StructInit(init codegen.StructInit) (codegen.Expr, codegen.Type) {
+	structure := c.Lookup(init.Path)
+
+	if structure != nil && structure.Kind != Struct {
+		c.errorf(init.Path, "%s is a %s, not a struct", structure.Name, structure.Kind)
+		structure = nil
+	}
+
+	if structure == nil {
+		for i, field := range init.Fields {
+			init.Fields[i].Expr, _ = c.Expr(field.Expr, nil)
+		}
+
+		return init, unknown{}
+	}
+
+	initialized := map[string]bool{}
+
+	for i, field := range init.Fields {
+		var declared codegen.Type
+
+		for _, f := range structure.Fields {
+			if f.Ident.Name == field.Ident.Name {
+				declared = f.Type
+			}
+		}
+
+		if declared == nil {
+			c.errorf(field.Ident, "%s has no field %s", structure.Name, field.Ident.Name)
+			init.Fields[i].Expr, _ = c.Expr(field.Expr, nil)
+
+			continue
+		}
+
+		if initialized[field.Ident.Name] {
+			c.errorf(field.Ident, "field %s is initialized twice", field.Ident.Name)
+		}
+
+		initialized[field.Ident.Name] = true
+		init.Fields[i].Expr = c.Typed(field.Expr, declared)
+	}
+
+	for _, f := range structure.Fields {
+		if !initialized[f.Ident.Name] {
+			c.errorf(init.Path, "missing field %s in initializer of %s", f.Ident.Name, structure.Name)
+		}
+	}
+
+	return init, structure.Type
+}
+
+func (c *Checker) Range(r codegen.Range) (codegen.Expr, codegen.Type) {
+	r.Lower = c.Typed(r.Lower, codegen.Int{})
+	r.Upper = c.Typed(r.Upper, codegen.Int{})
+
+	if r.Step != nil {
+		r.Step = c.Typed(r.Step, codegen.Int{})
+
+		// other steps of 0 panic when the range is iterated over
+		if isZero(r.Step) {
+			c.errorf(r.Step, "the step of a range cannot be 0")
+		}
+	}
+
+	return r, codegen.Range{}
+}
+
+// isZero reports whether an expression is the constant 0.
+func isZero(expr codegen.Expr) bool {
+	switch e := expr.(type) {
+	case codegen.Literal:
+		i, ok := e.Value.(codegen.Int)
+
+		return ok && i.Value == 0
+	case codegen.Unary:
+		return e.Op == lexer.MINUS && isZero(e.Expr)
+	}
+
+	return false
+}
+
+// isComparable reports whether values of the type can be compared with ==.
+func isComparable(typ codegen.Type) bool {
+	switch typ.(type) {
+	case codegen.Array, codegen.Vec, codegen.Map, codegen.Range, codegen.Reference, structType, enumType, codegen.Void:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,191 @@
+package check
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/whirl-lang/whirl/pkg/codegen"
+	"github.com/whirl-lang/whirl/pkg/diagnostic"
+)
+
+// Match checks a match and returns it with the types codegen needs. If it is
+// an expression, the arms must be values of the same type, which is returned.
+func (c *Checker) Match(match codegen.Match, expression bool) (codegen.Match, codegen.Type) {
+	var mutable bool
+
+	match.Expr, match.Type, mutable = c.operand(match.Expr)
+	enum, ok := match.Type.(enumType)
+
+	if !ok && !isUnknown(match.Type) {
+		c.errorf(match.Expr, "cannot match on a value of type %s", Name(match.Type))
+	}
+
+	var result codegen.Type
+	matched := map[*Symbol]bool{}
+	wildcard := false
+
+	for i, arm := range match.Arms {
+		c.scope = NewScope(c.scope)
+		variant := c.Pattern(&arm.Pattern, enum)
+
+		// the bindings are copies of the fields
+		if variant != nil && len(arm.Pattern.Bindings) == len(variant.Fields) {
+			for j, binding := range arm.Pattern.Bindings {
+				if binding.Name != "_" {
+					c.copyOut(binding, variant.Fields[j].Type, mutable)
+				}
+			}
+		}
+
+		switch {
+		case wildcard:
+			c.Diagnostics.Report(diagnostic.Warningf(arm.Pattern.Span, "this arm is unreachable, _ matches everything before it"))
+		case variant != nil && matched[variant]:
+			c.Diagnostics.Report(diagnostic.Warningf(arm.Pattern.Span, "this arm is unreachable, %s is already matched", variantName(variant, enum)))
+		}
+
+		if arm.Pattern.Variant == nil {
+			wildcard = true
+		} else if variant != nil {
+			matched[variant] = true
+		}
+
+		if arm.Value != nil {
+			var typ codegen.Type
+
+			arm.Value, typ = c.Expr(arm.Value, result)
+
+			if expression && result == nil {
+				result = typ
+			} else if expression {
+				c.expect(arm.Value, result, typ)
+			}
+		} else if expression {
+			c.errorf(arm, "the arms of a match expression must be values, not blocks")
+		}
+
+		for j, instruction := range arm.Body {
+			arm.Body[j] = c.Instruction(instruction)
+		}
+
+		c.scope = c.scope.Parent
+		match.Arms[i] = arm
+	}
+
+	if ok && !wildcard {
+		c.exhaustive(match, enum, matched)
+	}
+
+	if !expression {
+		return match, nil
+	}
+
+	if result == nil {
+		result = unknown{}
+	}
+
+	if _, ok := result.(codegen.Void); ok {
+		c.errorf(match, "the arms of a match expression cannot be of type void")
+		result = unknown{}
+	}
+
+	match.Result = result
+
+	return match, result
+}
+
+// Pattern checks a pattern against the enum that is matched on, declaring
+// its bindings in the current scope. It returns the matched variant, or nil
+// for _ and invalid patterns.
+func (c *Checker) Pattern(pattern *codegen.Pattern, enum enumType) *Symbol {
+	if pattern.Variant == nil {
+		return nil
+	}
+
+	variant := c.Lookup(*pattern.Variant)
+
+	if variant != nil && variant.Kind != Variant {
+		c.errorf(*pattern.Variant, "%s is a %s, not a variant", variant.Name, variant.Kind)
+		variant = nil
+	}
+
+	if variant != nil && enum.Symbol != nil && !Equal(variant.Type, enum) {
+		c.errorf(*pattern.Variant, "%s is not a variant of %s", variant.Name, enum.Symbol.Name)
+		variant = nil
+	}
+
+	// the variant still counts as matched, so it isn't reported as missing
+	if variant != nil && len(pattern.Bindings) > 0 && len(pattern.Bindings) != len(variant.Fields) {
+		c.errorf(*pattern, "%s has %d fields, but the pattern binds %d", variant.Name, len(variant.Fields), len(pattern.Bindings))
+
+		for _, binding := range pattern.Bindings {
+			c.bind(binding, unknown{})
+		}
+
+		return variant
+	}
+
+	if variant == nil {
+		for _, binding := range pattern.Bindings {
+			c.bind(binding, unknown{})
+		}
+
+		return nil
+	}
+
+	pattern.Tag = variant.Tag
+	pattern.Fields = variant.Fields
+
+	for i, binding := range pattern.Bindings {
+		c.bind(binding, variant.Fields[i].Type)
+	}
+
+	return variant
+}
+
+// bind declares a variable bound by a pattern, unless it is _.
+func (c *Checker) bind(binding codegen.Ident, typ codegen.Type) {
+	if binding.Name == "_" {
+		return
+	}
+
+	c.declare(&Symbol{Kind: Variable, Name: binding.Name, Span: binding.Span, Type: typ, Module: c.module})
+}
+
+// exhaustive reports the variants of enum a match without _ doesn't match.
+func (c *Checker) exhaustive(match codegen.Match, enum enumType, matched map[*Symbol]bool) {
+	var missing []*Symbol
+
+	for _, variant := range enum.Symbol.Variants.Symbols {
+		if !matched[variant] {
+			missing = append(missing, variant)
+		}
+	}
+
+	if len(missing) == 0 {
+		return
+	}
+
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].Tag < missing[j].Tag
+	})
+
+	names := make([]string, len(missing))
+
+	for i, variant := range missing {
+		names[i] = variantName(variant, enum)
+	}
+
+	verb := "are"
+
+	if len(names) == 1 {
+		verb = "is"
+	}
+
+	c.Diagnostics.Report(diagnostic.Errorf(codegen.SpanOf(match.Expr), "match is not exhaustive, %s %s not matched", strings.Join(names, ", "), verb).
+		WithNote("add an arm for each of them, or an arm _ => for the rest"))
+}
+
+func variantName(variant *Symbol, enum enumType) string {
+	return enum.Symbol.Name + "::" + variant.Name
+}
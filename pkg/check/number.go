@@ -0,0 +1,206 @@
+package check
+
+import (
+	"math"
+
+	"github.com/whirl-lang/whirl/pkg/codegen"
+	"github.com/whirl-lang/whirl/pkg/diagnostic"
+	"github.com/whirl-lang/whirl/pkg/lexer"
+)
+
+// arithmetic returns the type of an arithmetic operation or a comparison of
+// numbers. Chars count as ints. Both operands must be of the same type,
+// except that a number literal takes the type of the other operand.
+func (c *Checker) arithmetic(b codegen.Binary, left codegen.Type, right codegen.Type) codegen.Type {
+	op := lexer.TokensPretty[b.Op]
+
+	if !isNumeric(left) || !isNumeric(right) {
+		c.errorf(b, "cannot apply %s to %s and %s", op, Name(left), Name(right))
+
+		return unknown{}
+	}
+
+	left, right = promote(left), promote(right)
+
+	if isUnknown(left) || isUnknown(right) {
+		return unknown{}
+	}
+
+	var typ codegen.Type
+
+	switch {
+	case Equal(left, right):
+		typ = left
+	case adapts(b.Left, right):
+		c.fits(b.Left, right)
+		typ = right
+	case adapts(b.Right, left):
+		c.fits(b.Right, left)
+		typ = left
+	default:
+		c.Diagnostics.Report(diagnostic.Errorf(b.Span, "cannot apply %s to %s and %s", op, Name(left), Name(right)).
+			WithNote("convert one of them with as, like x as %s", Name(left)))
+
+		return unknown{}
+	}
+
+	if _, ok := typ.(codegen.Float); ok && b.Op == lexer.MOD {
+		c.errorf(b, "cannot apply %s to %s and %s", op, Name(left), Name(right))
+
+		return unknown{}
+	}
+
+	return typ
+}
+
+// Cast checks a conversion with as. Numbers can be converted to each other,
+// chars and bools to ints and ints to chars.
+func (c *Checker) Cast(cast codegen.Cast) (codegen.Expr, codegen.Type) {
+	var from codegen.Type
+
+	cast.Type = c.Resolve(cast.Type)
+	cast.Expr, from = c.Expr(cast.Expr, nil)
+
+	if !isUnknown(from) && !isUnknown(cast.Type) && !castable(from, cast.Type) {
+		c.errorf(cast, "cannot convert a value of type %s to %s", Name(from), Name(cast.Type))
+	}
+
+	return cast, cast.Type
+}
+
+func castable(from codegen.Type, to codegen.Type) bool {
+	switch to.(type) {
+	case codegen.Int:
+		switch from.(type) {
+		case codegen.Int, codegen.Float, codegen.Char, codegen.Bool:
+			return true
+		}
+	case codegen.Float:
+		return isNumber(from)
+	case codegen.Char:
+		switch from.(type) {
+		case codegen.Int, codegen.Char:
+			return true
+		}
+	}
+
+	return false
+}
+
+// fits reports an error if expr is an int literal that is out of the range
+// of the int type it is used as.
+func (c *Checker) fits(expr codegen.Expr, typ codegen.Type) {
+	value, negative, ok := constant(expr)
+	integer, isInt := typ.(codegen.Int)
+
+	if !ok || !isInt {
+		return
+	}
+
+	bits := integer.Bits
+
+	if bits == 0 {
+		bits = 32
+	}
+
+	// the largest values of either sign the type can hold
+	var positive, negated uint64
+
+	if integer.Unsigned {
+		positive = math.MaxUint64 >> (64 - bits)
+	} else {
+		positive = math.MaxUint64 >> (65 - bits)
+		negated = positive + 1
+	}
+
+	switch {
+	case negative && value > negated:
+		c.errorf(expr, "-%d does not fit in %s", value, Name(typ))
+	case !negative && value > positive:
+		c.errorf(expr, "%d does not fit in %s", value, Name(typ))
+	}
+}
+
+// untyped returns int or float if expr is made of number literals only,
+// which take the type of the value they are used as, and nil otherwise.
+func untyped(expr codegen.Expr) codegen.Type {
+	switch e := expr.(type) {
+	case codegen.Literal:
+		switch e.Value.(type) {
+		case codegen.Int:
+			return codegen.Int{}
+		case codegen.Float:
+			return codegen.Float{}
+		}
+	case codegen.Unary:
+		if e.Op == lexer.MINUS {
+			return untyped(e.Expr)
+		}
+	case codegen.Binary:
+		if e.Op < lexer.PLUS || e.Op > lexer.MOD {
+			return nil
+		}
+
+		left, right := untyped(e.Left), untyped(e.Right)
+
+		if left == nil || right == nil {
+			return nil
+		}
+
+		if _, ok := left.(codegen.Float); ok {
+			return left
+		}
+
+		return right
+	}
+
+	return nil
+}
+
+// adapts reports whether expr is made of number literals that can be used
+// as a value of type typ. Int literals can be used as any number, but
+// arithmetic on them is done on ints, so only a single one becomes a float.
+func adapts(expr codegen.Expr, typ codegen.Type) bool {
+	switch untyped(expr).(type) {
+	case codegen.Int:
+		switch typ.(type) {
+		case codegen.Int:
+			return true
+		case codegen.Float:
+			_, _, ok := constant(expr)
+			return ok
+		}
+	case codegen.Float:
+		_, ok := typ.(codegen.Float)
+		return ok
+	}
+
+	return false
+}
+
+// constant returns the value of an int literal, which may be negated, as
+// its magnitude and whether it is negative.
+func constant(expr codegen.Expr) (uint64, bool, bool) {
+	switch e := expr.(type) {
+	case codegen.Literal:
+		value, ok := e.Value.(codegen.Int)
+		return value.Value, false, ok
+	case codegen.Unary:
+		if e.Op == lexer.MINUS {
+			value, negative, ok := constant(e.Expr)
+			return value, !negative && value != 0, ok
+		}
+	}
+
+	return 0, false, false
+}
+
+// promote returns the type arithmetic on a value of type typ is done in,
+// which is int for chars.
+func promote(typ codegen.Type) codegen.Type {
+	if _, ok := typ.(codegen.Char); ok {
+		return codegen.Int{}
+	}
+
+	return typ
+}
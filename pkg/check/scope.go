@@ -0,0 +1,155 @@
+package check
+
+import (
+	"github.com/whirl-lang/whirl/pkg/codegen"
+	"github.com/whirl-lang/whirl/pkg/lexer"
+)
+
+type Kind int
+
+const (
+	Variable Kind = iota
+	Procedure
+	Struct
+	Module
+	Builtin
+	Enum
+	Variant
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Procedure:
+		return "procedure"
+	case Struct:
+		return "struct"
+	case Module:
+		return "module"
+	case Builtin:
+		return "builtin procedure"
+	case Enum:
+		return "enum"
+	case Variant:
+		return "variant"
+	}
+
+	return "variable"
+}
+
+// Symbol is anything a name can refer to.
+type Symbol struct {
+	Kind Kind
+	Name string
+	// Span is where the symbol is declared. It is empty for builtins.
+	Span lexer.Span
+	// Type is the type of a variable, the return type of a procedure or the
+	// type of values of a struct, an enum or a variant.
+	Type codegen.Type
+	// Args are the argument types of a procedure or the field types of a
+	// variant.
+	Args []codegen.Type
+	// Fields are the fields of a struct or a variant, with resolved types.
+	Fields []codegen.Field
+	// Variants holds the variants of an enum.
+	Variants *Scope
+	// Methods holds the methods of a struct.
+	Methods *Scope
+	// Self is set for methods that take the value they are called on as
+	// their first argument.
+	Self bool
+	// Tag is the index of a variant in its enum.
+	Tag int
+	// Module is the module a symbol is declared in, or for module symbols
+	// the module that is referred to.
+	Module *codegen.Module
+}
+
+// Scope holds the symbols declared in a block and links to the scope of the
+// enclosing block.
+type Scope struct {
+	Parent  *Scope
+	Symbols map[string]*Symbol
+}
+
+func NewScope(parent *Scope) *Scope {
+	return &Scope{Parent: parent, Symbols: map[string]*Symbol{}}
+}
+
+// Declare adds a symbol to the scope. If the name is already declared in
+// this scope the existing symbol is returned and nothing is added.
+func (s *Scope) Declare(symbol *Symbol) *Symbol {
+	if previous, ok := s.Symbols[symbol.Name]; ok {
+		return previous
+	}
+
+	s.Symbols[symbol.Name] = symbol
+
+	return nil
+}
+
+// Lookup finds a symbol in this scope or any of its parents.
+func (s *Scope) Lookup(name string) *Symbol {
+	for scope := s; scope != nil; scope = scope.Parent {
+		if symbol, ok := scope.Symbols[name]; ok {
+			return symbol
+		}
+	}
+
+	return nil
+}
+
+// Similar returns the visible name closest to name, or "" if none is close
+// enough to be a likely typo. Parent scopes are searched if parents is set.
+func (s *Scope) Similar(name string, parents bool) string {
+	best := ""
+	bestDistance := len(name)/3 + 2
+
+	for scope := s; scope != nil; scope = scope.Parent {
+		for candidate := range scope.Symbols {
+			distance := levenshtein(name, candidate)
+
+			// replacing every character isn't a typo
+			if distance >= len(name) || distance >= len(candidate) {
+				continue
+			}
+
+			if distance < bestDistance || (distance == bestDistance && best != "" && candidate < best) {
+				best = candidate
+				bestDistance = distance
+			}
+		}
+
+		if !parents {
+			break
+		}
+	}
+
+	return best
+}
+
+func levenshtein(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
@@ -0,0 +1,290 @@
+package check
+
+import (
+	"fmt"
+
+	"github.com/whirl-lang/whirl/pkg/codegen"
+)
+
+// unknown is the type of expressions that could not be typed. It is
+// compatible with every other type so that a mistake is only reported once.
+type unknown struct{}
+
+func (u unknown) CType(ctx codegen.Context) string {
+	return "void"
+}
+
+// structType is the type of values of a struct. Struct types are only equal
+// if they come from the same declaration.
+type structType struct {
+	Symbol *Symbol
+}
+
+func (s structType) CType(ctx codegen.Context) string {
+	return "struct " + codegen.Mangle(s.Symbol.Module.Namespace, s.Symbol.Name)
+}
+
+// enumType is the type of values of an enum. Like struct types, enum types
+// are only equal if they come from the same declaration.
+type enumType struct {
+	Symbol *Symbol
+}
+
+func (e enumType) CType(ctx codegen.Context) string {
+	return "struct " + codegen.Mangle(e.Symbol.Module.Namespace, e.Symbol.Name)
+}
+
+// Name returns the name of a type as it is written in Whirl.
+func Name(typ codegen.Type) string {
+	switch typ := typ.(type) {
+	case codegen.Int:
+		if typ.Bits == 0 {
+			return "int"
+		}
+
+		if typ.Unsigned {
+			return fmt.Sprintf("u%d", typ.Bits)
+		}
+
+		return fmt.Sprintf("i%d", typ.Bits)
+	case codegen.Float:
+		if typ.Bits == 0 {
+			return "float"
+		}
+
+		return fmt.Sprintf("f%d", typ.Bits)
+	case codegen.String:
+		return "string"
+	case codegen.Bool:
+		return "bool"
+	case codegen.Char:
+		return "char"
+	case codegen.Void:
+		return "void"
+	case codegen.Array:
+		return Name(typ.Type) + "[]"
+	case codegen.Vec:
+		return "Vec<" + Name(typ.Type) + ">"
+	case codegen.Map:
+		return "map<" + Name(typ.Key) + ", " + Name(typ.Value) + ">"
+	case codegen.Range:
+		return "range"
+	case codegen.Reference:
+		if typ.Mutable {
+			return "&mut " + Name(typ.Type)
+		}
+
+		return "&" + Name(typ.Type)
+	case structType:
+		return typ.Symbol.Name
+	case enumType:
+		return typ.Symbol.Name
+	}
+
+	return "{unknown}"
+}
+
+// Equal reports whether two types are the same.
+func Equal(a codegen.Type, b codegen.Type) bool {
+	if isUnknown(a) || isUnknown(b) {
+		return true
+	}
+
+	switch a := a.(type) {
+	case codegen.Int:
+		b, ok := b.(codegen.Int)
+		return ok && a.Bits == b.Bits && a.Unsigned == b.Unsigned
+	case codegen.Float:
+		// float is another name for f64
+		b, ok := b.(codegen.Float)
+		return ok && (a.Bits == 32) == (b.Bits == 32)
+	case codegen.String:
+		_, ok := b.(codegen.String)
+		return ok
+	case codegen.Bool:
+		_, ok := b.(codegen.Bool)
+		return ok
+	case codegen.Char:
+		_, ok := b.(codegen.Char)
+		return ok
+	case codegen.Void:
+		_, ok := b.(codegen.Void)
+		return ok
+	case codegen.Array:
+		b, ok := b.(codegen.Array)
+		return ok && Equal(a.Type, b.Type)
+	case codegen.Vec:
+		b, ok := b.(codegen.Vec)
+		return ok && Equal(a.Type, b.Type)
+	case codegen.Map:
+		b, ok := b.(codegen.Map)
+		return ok && Equal(a.Key, b.Key) && Equal(a.Value, b.Value)
+	case codegen.Range:
+		_, ok := b.(codegen.Range)
+		return ok
+	case codegen.Reference:
+		b, ok := b.(codegen.Reference)
+		return ok && a.Mutable == b.Mutable && Equal(a.Type, b.Type)
+	case structType:
+		b, ok := b.(structType)
+		return ok && a.Symbol == b.Symbol
+	case enumType:
+		b, ok := b.(enumType)
+		return ok && a.Symbol == b.Symbol
+	}
+
+	return false
+}
+
+// assignable reports whether a value of type got can be used where a value
+// of type expected is needed. Besides equal types, a mutable reference can be
+// used as an immutable one.
+func assignable(expected codegen.Type, got codegen.Type) bool {
+	e, ok := expected.(codegen.Reference)
+	g, isReference := got.(codegen.Reference)
+
+	if ok && isReference && !e.Mutable && g.Mutable {
+		return Equal(e.Type, g.Type)
+	}
+
+	return Equal(expected, got)
+}
+
+// through dereferences expr if it is a reference, as field accesses,
+// indexing and other uses of the value it refers to see through references.
+func through(expr codegen.Expr, typ codegen.Type) (codegen.Expr, codegen.Type) {
+	if reference, ok := typ.(codegen.Reference); ok {
+		return codegen.Deref{Expr: expr, Span: codegen.SpanOf(expr)}, reference.Type
+	}
+
+	return expr, typ
+}
+
+// shares reports whether copies of a value of the type share elements that
+// can be changed, which they do if it holds an array, a vector or a map.
+func shares(typ codegen.Type) bool {
+	switch t := typ.(type) {
+	case codegen.Array, codegen.Vec, codegen.Map:
+		return true
+	case structType:
+		for _, field := range t.Symbol.Fields {
+			if shares(field.Type) {
+				return true
+			}
+		}
+	case enumType:
+		for _, variant := range t.Symbol.Variants.Symbols {
+			for _, field := range variant.Fields {
+				if shares(field.Type) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// holdsReference reports whether values of the type contain a reference.
+// Fields can't be references, so only arrays, vectors and maps of them do.
+func holdsReference(typ codegen.Type) bool {
+	switch t := typ.(type) {
+	case codegen.Reference:
+		return true
+	case codegen.Array:
+		return holdsReference(t.Type)
+	case codegen.Vec:
+		return holdsReference(t.Type)
+	case codegen.Map:
+		return holdsReference(t.Key) || holdsReference(t.Value)
+	}
+
+	return false
+}
+
+// inVec reports whether a place is an element of a vector, or a field of
+// one, which moves when the vector grows.
+func inVec(expr codegen.Expr) bool {
+	for {
+		switch e := expr.(type) {
+		case codegen.FieldAccess:
+			expr = e.Expr
+		case codegen.Index:
+			return e.Vec != nil
+		default:
+			return false
+		}
+	}
+}
+
+// isKey reports whether values of a type can be map keys, which they can if
+// they can be hashed and compared.
+func isKey(typ codegen.Type) bool {
+	switch t := typ.(type) {
+	case codegen.Int, codegen.Char, codegen.Bool, codegen.String, unknown:
+		return true
+	case structType:
+		for _, field := range t.Symbol.Fields {
+			if !isKey(field.Type) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+func isUnknown(typ codegen.Type) bool {
+	_, ok := typ.(unknown)
+
+	return typ == nil || ok
+}
+
+// areStrings reports whether the operands of a binary operator are strings,
+// at least one of them known to be.
+func areStrings(left codegen.Type, right codegen.Type) bool {
+	_, l := left.(codegen.String)
+	_, r := right.(codegen.String)
+
+	return (l || r) && Equal(left, codegen.String{}) && Equal(right, codegen.String{})
+}
+
+// isNumeric reports whether arithmetic can be done on values of the type.
+func isNumeric(typ codegen.Type) bool {
+	switch typ.(type) {
+	case codegen.Int, codegen.Float, codegen.Char, unknown:
+		return true
+	}
+
+	return false
+}
+
+// isNumber reports whether a type is one of the int or float types.
+func isNumber(typ codegen.Type) bool {
+	switch typ.(type) {
+	case codegen.Int, codegen.Float:
+		return true
+	}
+
+	return false
+}
+
+// typeOf returns the type of a literal value.
+func typeOf(value codegen.Value) codegen.Type {
+	switch value.(type) {
+	case codegen.Int:
+		return codegen.Int{}
+	case codegen.Float:
+		return codegen.Float{}
+	case codegen.String:
+		return codegen.String{}
+	case codegen.Bool:
+		return codegen.Bool{}
+	case codegen.Char:
+		return codegen.Char{}
+	}
+
+	return unknown{}
+}
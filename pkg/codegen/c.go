@@ -3,9 +3,11 @@ package codegen
 import (
 	"bytes"
 	"fmt"
-	"os"
-	"path"
+	"math"
 	"strconv"
+	"strings"
+
+	"github.com/whirl-lang/whirl/pkg/lexer"
 )
 
 type CType interface {
@@ -21,19 +23,112 @@ type CInstruction interface {
 }
 
 func (i Int) CType(ctx Context) string {
-	return "int"
+	if i.Bits == 0 {
+		return "int"
+	}
+
+	if i.Unsigned {
+		return fmt.Sprintf("uint%d_t", i.Bits)
+	}
+
+	return fmt.Sprintf("int%d_t", i.Bits)
+}
+
+func (f Float) CType(ctx Context) string {
+	if f.Bits == 32 {
+		return "float"
+	}
+
+	return "double"
+}
+
+// CValue always has a period or an exponent, so that C doesn't take it for
+// an int.
+func (f Float) CValue(ctx Context) string {
+	value := strconv.FormatFloat(f.Value, 'g', -1, 64)
+
+	if !strings.ContainsAny(value, ".e") {
+		value += ".0"
+	}
+
+	return value
 }
 
+// CType is a struct of a pointer to the characters and their number. The
+// characters are always followed by a NUL, so they can be passed to C.
 func (s String) CType(ctx Context) string {
-	return "char*"
+	return "struct __whirl_string"
 }
 
+// CValue of a literal points to the characters of a C literal, whose length
+// C knows.
 func (s String) CValue(ctx Context) string {
-	return "\"" + s.Value + "\""
+	literal := quote(s.Value)
+
+	return fmt.Sprintf("((struct __whirl_string) { %s, sizeof(%s) - 1 })", literal, literal)
 }
 
+// quote returns the C literal of the characters of a string.
+func quote(value string) string {
+	var buffer bytes.Buffer
+
+	buffer.WriteByte('"')
+
+	for i := 0; i < len(value); i++ {
+		// ?? starts a trigraph
+		if value[i] == '?' && i > 0 && value[i-1] == '?' {
+			buffer.WriteString("\\?")
+
+			continue
+		}
+
+		buffer.WriteString(escape(value[i], '"'))
+	}
+
+	buffer.WriteByte('"')
+
+	return buffer.String()
+}
+
+// escape returns a character as it is written in a C literal delimited by
+// quote. Characters that can't be written as they are become octal escapes,
+// which unlike hex ones end after three digits, so they can't run into the
+// characters after them.
+func escape(c byte, quote byte) string {
+	switch {
+	case c == quote || c == '\\':
+		return "\\" + string(c)
+	case c == '\n':
+		return "\\n"
+	case c == '\t':
+		return "\\t"
+	case c < ' ' || c >= 0x7f:
+		return fmt.Sprintf("\\%03o", c)
+	}
+
+	return string(c)
+}
+
+// CValue is a C literal for string literals, so that C compilers can check
+// printf formats, and the characters of other strings.
+func (s CString) CValue(ctx Context) string {
+	if literal, ok := s.Expr.(Literal); ok {
+		if value, ok := literal.Value.(String); ok {
+			return quote(value.Value)
+		}
+	}
+
+	return s.Expr.CValue(ctx) + ".data"
+}
+
+// CValue of a value too large for any signed type of C has to be marked
+// unsigned.
 func (i Int) CValue(ctx Context) string {
-	return strconv.FormatInt(i.Value, 10)
+	if i.Value > math.MaxInt64 {
+		return strconv.FormatUint(i.Value, 10) + "ull"
+	}
+
+	return strconv.FormatUint(i.Value, 10)
 }
 
 func (b Bool) CType(ctx Context) string {
@@ -53,7 +148,7 @@ func (c Char) CType(ctx Context) string {
 }
 
 func (c Char) CValue(ctx Context) string {
-	return "'" + string(c.Value) + "'"
+	return "'" + escape(byte(c.Value), '\'') + "'"
 }
 
 func (v Void) CType(ctx Context) string {
@@ -64,6 +159,11 @@ func (i Ident) CType(ctx Context) string {
 	return TransformIdent(ctx, i.Name)
 }
 
+// CValue refers to a local variable, which is never namespaced.
+func (i Ident) CValue(ctx Context) string {
+	return cName(i.Name)
+}
+
 func (p Path) CType(ctx Context) string {
 	return p.CValue(ctx)
 }
@@ -72,34 +172,40 @@ func (p Path) CValue(ctx Context) string {
 	return TransformPath(ctx, p)
 }
 
-func (a Array) CType(ctx Context) string {
-	return a.Type.CType(ctx)
-}
+// Prototype returns the C declaration of the procedure, without its body.
+func (p Procedure) Prototype(ctx Context) string {
+	var buffer bytes.Buffer
 
-func (a Array) Brackets() string {
-	switch a.Type.(type) {
-	case Array:
-		//incase we somehow ever need 2d array (bad we need Vec)
-		return "[]" + a.Type.(Array).Brackets()
-	}
+	buffer.WriteString(p.ReturnType.CType(ctx))
+	buffer.WriteString(" ")
 
-	return "[]"
-}
+	switch {
+	case p.takesCommandLine(ctx):
+		buffer.WriteString(entryPoint)
+	case p.Receiver != nil:
+		buffer.WriteString(MangleMethod(ctx.Module.Namespace, p.Receiver.Name, p.Ident.Name))
+	default:
+		buffer.WriteString(p.Ident.CType(ctx))
+	}
 
-func (a Array) CValue(ctx Context) string {
-	var buffer bytes.Buffer
+	buffer.WriteString("(")
 
-	buffer.WriteString("{")
+	// an empty list would leave the arguments unspecified in C
+	if len(p.Args) == 0 {
+		buffer.WriteString("void")
+	}
 
-	for i, value := range a.Value {
-		buffer.WriteString(value.(Value).CValue(ctx))
+	for i, arg := range p.Args {
+		buffer.WriteString(arg.Type.CType(ctx))
+		buffer.WriteString(" ")
+		buffer.WriteString(cName(arg.Ident.Name))
 
-		if i != len(a.Value)-1 {
+		if i != len(p.Args)-1 {
 			buffer.WriteString(", ")
 		}
 	}
 
-	buffer.WriteString("}")
+	buffer.WriteString(")")
 
 	return buffer.String()
 }
@@ -107,22 +213,8 @@ func (a Array) CValue(ctx Context) string {
 func (p Procedure) CInstruction(ctx Context) string {
 	var buffer bytes.Buffer
 
-	buffer.WriteString(p.ReturnType.CType(ctx))
-	buffer.WriteString(" ")
-	buffer.WriteString(p.Ident.CType(ctx))
-	buffer.WriteString("(")
-
-	for i, arg := range p.Args {
-		buffer.WriteString(arg.Type.CType(ctx))
-		buffer.WriteString(" ")
-		buffer.WriteString(arg.Ident.Name)
-
-		if i != len(p.Args)-1 {
-			buffer.WriteString(", ")
-		}
-	}
-
-	buffer.WriteString(") { ")
+	buffer.WriteString(p.Prototype(ctx))
+	buffer.WriteString(" { ")
 
 	for _, instruction := range p.Instructions {
 		buffer.WriteString(instruction.CInstruction(ctx))
@@ -131,9 +223,24 @@ func (p Procedure) CInstruction(ctx Context) string {
 
 	buffer.WriteString("}")
 
+	// C's main gets the arguments as argc and argv, which includes the name
+	// of the program
+	if p.takesCommandLine(ctx) {
+		buffer.WriteString("\nint main(int argc, char** argv) { ")
+		fmt.Fprintf(&buffer, "%s args = { __whirl_alloc(NULL, sizeof(struct __whirl_string) * argc, %s), argc - 1 }; ", p.Args[0].Type.CType(ctx), position(p.Span))
+		buffer.WriteString("for (int i = 1; i < argc; i++) args.data[i - 1] = __whirl_string_c(argv[i]); ")
+		fmt.Fprintf(&buffer, "return %s(args); }", entryPoint)
+	}
+
 	return buffer.String()
 }
 
+// takesCommandLine reports whether p is the main procedure of the program
+// and takes the command line arguments.
+func (p Procedure) takesCommandLine(ctx Context) bool {
+	return p.Ident.Name == "main" && p.Receiver == nil && ctx.Module.Namespace == "" && len(p.Args) > 0
+}
+
 func (s Struct) CType(ctx Context) string {
 	var buffer bytes.Buffer
 
@@ -144,7 +251,7 @@ func (s Struct) CType(ctx Context) string {
 	for _, field := range s.Fields {
 		buffer.WriteString(field.Type.CType(ctx))
 		buffer.WriteString(" ")
-		buffer.WriteString(field.Ident.CType(ctx))
+		buffer.WriteString(cName(field.Ident.Name))
 
 		buffer.WriteString("; ")
 	}
@@ -156,23 +263,24 @@ func (s Struct) CType(ctx Context) string {
 
 func (a Assignment) CInstruction(ctx Context) string {
 	switch a.Type.(type) {
-	case Ident:
-		return fmt.Sprintf("struct %s %s = %s;", a.Type.CType(ctx), a.Ident.Name, a.Expr.(Value).CValue(ctx))
-	case Array:
-		return fmt.Sprintf("%s %s%s = %s;", a.Type.CType(ctx), a.Ident.Name, a.Type.(Array).Brackets(), a.Expr.(Value).CValue(ctx))
+	case Ident, Path:
+		return fmt.Sprintf("struct %s %s = %s;", a.Type.CType(ctx), cName(a.Ident.Name), a.Expr.(Value).CValue(ctx))
 	}
 
-	return fmt.Sprintf("%s %s = %s;", a.Type.CType(ctx), a.Ident.Name, a.Expr.(Value).CValue(ctx))
+	return fmt.Sprintf("%s %s = %s;", a.Type.CType(ctx), cName(a.Ident.Name), a.Expr.(Value).CValue(ctx))
 }
 
 func (s StructInit) CValue(ctx Context) string {
 	var buffer bytes.Buffer
 
-	buffer.WriteString(" { ")
+	// a compound literal, so it can be used in any expression
+	buffer.WriteString("(struct ")
+	buffer.WriteString(s.Path.CType(ctx))
+	buffer.WriteString(") { ")
 
 	for i, field := range s.Fields {
 		buffer.WriteString(".")
-		buffer.WriteString(field.Ident.CType(ctx))
+		buffer.WriteString(cName(field.Ident.Name))
 		buffer.WriteString(" = ")
 		buffer.WriteString(field.Expr.(Value).CValue(ctx))
 
@@ -237,12 +345,26 @@ func (i If) CInstruction(ctx Context) string {
 	return buffer.String()
 }
 
+// CInstruction also ends the iterations of the maps the enclosing loops go
+// over, which the loops only do when they finish.
 func (esc Escape) CInstruction(ctx Context) string {
-	return fmt.Sprintf("return %s;", esc.Expr.(Value).CValue(ctx))
+	var buffer bytes.Buffer
+
+	for _, iterating := range ctx.iterating {
+		fmt.Fprintf(&buffer, "%s->iterating--; ", iterating)
+	}
+
+	fmt.Fprintf(&buffer, "return %s;", esc.Expr.(Value).CValue(ctx))
+
+	return buffer.String()
 }
 
 func (r Reassign) CInstruction(ctx Context) string {
-	return fmt.Sprintf("%s = %s;", r.Ident, r.Expr.(Value).CValue(ctx))
+	return fmt.Sprintf("%s = %s;", r.Target.CValue(ctx), r.Expr.CValue(ctx))
+}
+
+func (d Discard) CInstruction(ctx Context) string {
+	return fmt.Sprintf("(void) %s;", d.Expr.CValue(ctx))
 }
 
 func (b Break) CInstruction(ctx Context) string {
@@ -253,55 +375,141 @@ func (c Continue) CInstruction(ctx Context) string {
 	return "continue;"
 }
 
+// CInstruction loops over a hidden index, so the iterable is evaluated once
+// and changing the loop variables doesn't change the iteration. The length
+// of a vector is read on every iteration, as the body can push and pop.
 func (i Iter) CInstruction(ctx Context) string {
 	var buffer bytes.Buffer
+	var length, element, typ string
 
-	buffer.WriteString("for (int ")
-	buffer.WriteString(i.Ident.Name)
-	buffer.WriteString(" = ")
-	buffer.WriteString(i.Lower.CValue(ctx))
-	buffer.WriteString("; ")
-	buffer.WriteString(i.Ident.Name)
-	buffer.WriteString(" < ")
-	buffer.WriteString(i.Upper.CValue(ctx))
-	buffer.WriteString("; ")
-	buffer.WriteString(i.Ident.Name)
-	buffer.WriteString("++) { ")
+	bound := "__whirl_length"
 
+	switch t := i.Type.(type) {
+	case Map:
+		return i.iterMap(ctx, t)
+	case Array:
+		length = "__whirl_iterable.len"
+		element = "__whirl_iterable.data[__whirl_index]"
+		typ = t.Type.CType(ctx)
+	case Vec:
+		bound = "__whirl_iterable->len"
+		element = fmt.Sprintf("(*%s_at(__whirl_iterable, __whirl_index, %s))", t.name(ctx), position(SpanOf(i.Iterable)))
+		typ = t.Type.CType(ctx)
+	case String:
+		length = "__whirl_iterable.len"
+		element = "__whirl_iterable.data[__whirl_index]"
+		typ = "char"
+	default:
+		length = "__whirl_range_len(__whirl_iterable, " + position(SpanOf(i.Iterable)) + ")"
+		element = "__whirl_iterable.lower + __whirl_index * __whirl_iterable.step"
+		typ = "int"
+	}
+
+	fmt.Fprintf(&buffer, "{ %s __whirl_iterable = %s; ", i.Type.CType(ctx), i.Iterable.CValue(ctx))
+
+	if length != "" {
+		fmt.Fprintf(&buffer, "int __whirl_length = %s; ", length)
+	}
+
+	fmt.Fprintf(&buffer, "for (int __whirl_index = 0; __whirl_index < %s; __whirl_index++) { ", bound)
+
+	// the loop variables don't have to be used
+	if i.Index != nil {
+		fmt.Fprintf(&buffer, "int %s = __whirl_index; (void) %s; ", cName(i.Index.Name), cName(i.Index.Name))
+	}
+
+	fmt.Fprintf(&buffer, "%s %s = %s; (void) %s; ", typ, cName(i.Ident.Name), element, cName(i.Ident.Name))
+	i.writeBody(ctx, &buffer)
+	buffer.WriteString(" }")
+
+	return buffer.String()
+}
+
+// iterMap loops over the entries of a map in the order they were inserted,
+// skipping removed ones. With two variables, the first is the key and the
+// second the value, otherwise the variable is the key. The number of entries
+// is read on every iteration, as the body can insert, and the map is marked
+// as iterated, so that it isn't compacted before the loop is done.
+func (i Iter) iterMap(ctx Context, m Map) string {
+	var buffer bytes.Buffer
+
+	iterating := fmt.Sprintf("__whirl_iterating%d", len(ctx.iterating))
+	ctx.iterating = append(ctx.iterating[:len(ctx.iterating):len(ctx.iterating)], iterating)
+
+	fmt.Fprintf(&buffer, "{ %s __whirl_iterable = %s; ", m.CType(ctx), i.Iterable.CValue(ctx))
+	fmt.Fprintf(&buffer, "%s %s = __whirl_iterable; %s->iterating++; ", m.CType(ctx), iterating, iterating)
+	buffer.WriteString("for (int __whirl_index = 0; __whirl_index < __whirl_iterable->count; __whirl_index++) { ")
+	buffer.WriteString("if (!__whirl_iterable->alive[__whirl_index]) continue; ")
+
+	key := i.Ident
+
+	if i.Index != nil {
+		key = *i.Index
+		fmt.Fprintf(&buffer, "%s %s = __whirl_iterable->values[__whirl_index]; (void) %s; ", m.Value.CType(ctx), cName(i.Ident.Name), cName(i.Ident.Name))
+	}
+
+	fmt.Fprintf(&buffer, "%s %s = __whirl_iterable->keys[__whirl_index]; (void) %s; ", m.Key.CType(ctx), cName(key.Name), cName(key.Name))
+	i.writeBody(ctx, &buffer)
+	fmt.Fprintf(&buffer, " %s->iterating--; }", iterating)
+
+	return buffer.String()
+}
+
+// writeBody writes the body of the loop and closes the loop, but not the
+// block around it.
+func (i Iter) writeBody(ctx Context, buffer *bytes.Buffer) {
 	for _, instruction := range i.Body {
 		buffer.WriteString(instruction.CInstruction(ctx))
 		buffer.WriteString(" ")
 	}
 
 	buffer.WriteString("}")
+}
 
-	return buffer.String()
+func (r Range) CType(ctx Context) string {
+	return "struct __whirl_range"
 }
 
-func (e ExprMath) CValue(ctx Context) string {
-	var buffer bytes.Buffer
+func (r Range) CValue(ctx Context) string {
+	step := "1"
+	inclusive := 0
 
-	for _, token := range e.Tokens {
-		buffer.WriteString(token.CValue(ctx))
+	if r.Step != nil {
+		step = r.Step.CValue(ctx)
 	}
 
-	return buffer.String()
+	if r.Inclusive {
+		inclusive = 1
+	}
+
+	return fmt.Sprintf("(struct __whirl_range) { %s, %s, %s, %d }", r.Lower.CValue(ctx), r.Upper.CValue(ctx), step, inclusive)
 }
 
-func (e ExprToken) CValue(ctx Context) string {
-	return e.Token.Value
+func (b Binary) CValue(ctx Context) string {
+	return fmt.Sprintf("(%s %s %s)", b.Left.CValue(ctx), lexer.TokensPretty[b.Op], b.Right.CValue(ctx))
 }
 
-func (p ProcedureCall) CValue(ctx Context) string {
+func (u Unary) CValue(ctx Context) string {
+	return fmt.Sprintf("(%s%s)", lexer.TokensPretty[u.Op], u.Expr.CValue(ctx))
+}
+
+func (c Call) CValue(ctx Context) string {
 	var buffer bytes.Buffer
 
-	buffer.WriteString(p.Ident.CType(ctx))
+	// procedures live in the namespace of their module, unlike variables
+	switch callee := c.Callee.(type) {
+	case Ident:
+		buffer.WriteString(TransformPath(ctx, Path{Tokens: []Ident{callee}}))
+	default:
+		buffer.WriteString(callee.CValue(ctx))
+	}
+
 	buffer.WriteString("(")
 
-	for i, arg := range p.Args {
-		buffer.WriteString(arg.(Value).CValue(ctx))
+	for i, arg := range c.Args {
+		buffer.WriteString(arg.CValue(ctx))
 
-		if i != len(p.Args)-1 {
+		if i != len(c.Args)-1 {
 			buffer.WriteString(", ")
 		}
 	}
@@ -311,20 +519,182 @@ func (p ProcedureCall) CValue(ctx Context) string {
 	return buffer.String()
 }
 
-func (p ProcedureCall) CInstruction(ctx Context) string {
-	return fmt.Sprintf("%s;", p.CValue(ctx))
+func (c Cast) CValue(ctx Context) string {
+	return fmt.Sprintf("((%s) %s)", c.Type.CType(ctx), c.Expr.CValue(ctx))
 }
 
+func (a AddressOf) CValue(ctx Context) string {
+	return fmt.Sprintf("(&%s)", a.Expr.CValue(ctx))
+}
+
+func (d Deref) CValue(ctx Context) string {
+	return fmt.Sprintf("(*%s)", d.Expr.CValue(ctx))
+}
+
+// CType of a reference is a pointer, whatever its mutability.
+func (r Reference) CType(ctx Context) string {
+	return r.Type.CType(ctx) + "*"
+}
+
+func (m Method) CValue(ctx Context) string {
+	return MangleMethod(m.Namespace, m.Receiver, m.Ident.Name)
+}
+
+func (c Call) CInstruction(ctx Context) string {
+	return fmt.Sprintf("%s;", c.CValue(ctx))
+}
+
+func (f FieldAccess) CValue(ctx Context) string {
+	return fmt.Sprintf("%s.%s", f.Expr.CValue(ctx), cName(f.Field.Name))
+}
+
+func (l Literal) CValue(ctx Context) string {
+	return l.Value.CValue(ctx)
+}
+
+// CInstruction is empty, WriteModule writes imported modules before the
+// modules that import them.
 func (i Import) CInstruction(ctx Context) string {
-	c, err := os.ReadFile(path.Join(ctx.Path, i.Path))
+	return ""
+}
+
+// CType is a struct of the tag of the variant and a union of the fields of
+// the variants that have any.
+func (e Enum) CType(ctx Context) string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("struct ")
+	buffer.WriteString(e.Ident.CType(ctx))
+	buffer.WriteString(" { int tag; ")
+
+	var union bytes.Buffer
+
+	for _, variant := range e.Variants {
+		if len(variant.Fields) == 0 {
+			continue
+		}
+
+		union.WriteString("struct { ")
+
+		for _, field := range variant.Fields {
+			union.WriteString(field.Type.CType(ctx))
+			union.WriteString(" ")
+			union.WriteString(cName(field.Ident.Name))
+			union.WriteString("; ")
+		}
 
-	if err != nil {
-		panic(err)
+		union.WriteString("} ")
+		union.WriteString(cName(variant.Ident.Name))
+		union.WriteString("; ")
 	}
 
-	buf := bytes.NewBufferString("")
+	// C doesn't allow empty unions
+	if union.Len() > 0 {
+		buffer.WriteString("union { ")
+		buffer.Write(union.Bytes())
+		buffer.WriteString("} data; ")
+	}
+
+	buffer.WriteString("}")
+
+	return buffer.String()
+}
+
+func (e Enum) CInstruction(ctx Context) string {
+	return e.CType(ctx) + ";"
+}
+
+func (v VariantInit) CValue(ctx Context) string {
+	var buffer bytes.Buffer
+
+	fmt.Fprintf(&buffer, "(%s) { .tag = %d", v.Type.CType(ctx), v.Tag)
+
+	if len(v.Args) > 0 {
+		fmt.Fprintf(&buffer, ", .data.%s = { ", cName(v.Variant.Name))
+
+		for i, arg := range v.Args {
+			buffer.WriteString(arg.CValue(ctx))
+
+			if i != len(v.Args)-1 {
+				buffer.WriteString(", ")
+			}
+		}
+
+		buffer.WriteString(" }")
+	}
+
+	buffer.WriteString(" }")
+
+	return buffer.String()
+}
+
+// CInstruction is a chain of ifs on the tag, so break and continue in the
+// arms still refer to the enclosing loop.
+func (m Match) CInstruction(ctx Context) string {
+	var buffer bytes.Buffer
+
+	fmt.Fprintf(&buffer, "{ %s __whirl_match = %s; ", m.Type.CType(ctx), m.Expr.CValue(ctx))
+	m.arms(ctx, &buffer, "")
+	buffer.WriteString("}")
+
+	return buffer.String()
+}
+
+// CValue is a statement expression, a GNU extension that tcc, gcc and clang
+// all support, assigning the value of the arm that runs to a variable.
+func (m Match) CValue(ctx Context) string {
+	var buffer bytes.Buffer
+
+	fmt.Fprintf(&buffer, "({ %s __whirl_match = %s; %s __whirl_result; ", m.Type.CType(ctx), m.Expr.CValue(ctx), m.Result.CType(ctx))
+	m.arms(ctx, &buffer, "__whirl_result = ")
+	buffer.WriteString("__whirl_result; })")
 
-	ctx.Transpile(c, path.Join(ctx.Path, i.Path), buf)
+	return buffer.String()
+}
+
+// arms writes the arms, prefixing the values of the arms with assign. The
+// checker makes sure the arms are exhaustive, so the last one always runs
+// if the others don't.
+func (m Match) arms(ctx Context, buffer *bytes.Buffer, assign string) {
+	for i, arm := range m.Arms {
+		if i > 0 {
+			buffer.WriteString("else ")
+		}
+
+		if arm.Pattern.Variant != nil && i != len(m.Arms)-1 {
+			fmt.Fprintf(buffer, "if (__whirl_match.tag == %d) ", arm.Pattern.Tag)
+		}
 
-	return buf.String()
+		buffer.WriteString("{ ")
+
+		for j, binding := range arm.Pattern.Bindings {
+			if binding.Name == "_" {
+				continue
+			}
+
+			field := arm.Pattern.Fields[j]
+			fmt.Fprintf(buffer, "%s %s = __whirl_match.data.%s.%s; (void) %s; ",
+				field.Type.CType(ctx), cName(binding.Name), cName(arm.Pattern.Variant.Tokens[len(arm.Pattern.Variant.Tokens)-1].Name), cName(field.Ident.Name), cName(binding.Name))
+		}
+
+		if arm.Value != nil {
+			if assign == "" {
+				buffer.WriteString("(void) ")
+			}
+
+			fmt.Fprintf(buffer, "%s%s; ", assign, arm.Value.CValue(ctx))
+		}
+
+		for _, instruction := range arm.Body {
+			buffer.WriteString(instruction.CInstruction(ctx))
+			buffer.WriteString(" ")
+		}
+
+		buffer.WriteString("} ")
+
+		// nothing after _ can run
+		if arm.Pattern.Variant == nil {
+			return
+		}
+	}
 }
@@ -2,37 +2,202 @@ package codegen
 
 import (
 	"bufio"
+	"bytes"
+	"fmt"
 	"io"
+	"strings"
+
+	"github.com/whirl-lang/whirl/pkg/diagnostic"
 )
 
-type InstructionIterator interface {
-	Next() (Instruction, error)
+// Module is a parsed source file together with the modules it imports.
+type Module struct {
+	// Name is how the module is referred to in paths, e.g. b in b::hello.
+	Name string
+	Path string
+	// Namespace prefixes the C names of the module's symbols. It is empty
+	// for the main module.
+	Namespace    string
+	Instructions []Instruction
+	Imports      map[string]*Module
+}
+
+// Dependencies lists the module and everything it imports, every module
+// after the modules it imports.
+func (m *Module) Dependencies() []*Module {
+	return m.dependencies(nil, map[*Module]bool{})
+}
+
+func (m *Module) dependencies(modules []*Module, seen map[*Module]bool) []*Module {
+	seen[m] = true
+
+	for _, instruction := range m.Instructions {
+		if imp, ok := instruction.(Import); ok && imp.Module != nil && !seen[imp.Module] {
+			modules = imp.Module.dependencies(modules, seen)
+		}
+	}
+
+	return append(modules, m)
 }
 
 type Context struct {
-	Namespace string
-	Path      string
-	Transpile func(content []byte, path string, out io.Writer)
+	Module      *Module
+	Diagnostics *diagnostic.Collector
+
+	// arrays, vecs and maps record the C structs of the array, vector and
+	// map types used, by name
+	arrays map[string]Type
+	vecs   map[string]Type
+	maps   map[string]Map
+	// structs holds the fields of every struct by C name, to hash and
+	// compare them as map keys
+	structs map[string][]Field
+	// iterating names the variables pointing to the maps the enclosing
+	// loops go over, which an escape has to mark as no longer iterated
+	iterating []string
 }
 
-func WriteC(ctx Context, nodes InstructionIterator, out io.Writer) error {
+// WithModule returns a context for emitting the instructions of module.
+func (ctx Context) WithModule(module *Module) Context {
+	ctx.Module = module
+
+	return ctx
+}
+
+// WriteModule writes the C code of a module and everything it imports. The
+// structs and procedure prototypes of all modules come first, so procedures
+// can be used before they are defined and call each other.
+func WriteModule(ctx Context, module *Module, out io.Writer) error {
+	modules := module.Dependencies()
+	ctx.arrays = map[string]Type{}
+	ctx.vecs = map[string]Type{}
+	ctx.maps = map[string]Map{}
+	ctx.structs = map[string][]Field{}
+
+	// the code is generated before it is written, because the array,
+	// vector and map types it uses have to be declared first
+	var declarations, structs, code bytes.Buffer
+	var definitions []typeDeclaration
+
+	for _, module := range modules {
+		for _, instruction := range module.Instructions {
+			var definition typeDeclaration
+
+			switch t := instruction.(type) {
+			case Struct:
+				definition = typeDeclaration{ctx.WithModule(module), t.Ident, t.Fields, t}
+				ctx.structs[t.Ident.CType(definition.Context)] = t.Fields
+			case Enum:
+				definition = typeDeclaration{ctx.WithModule(module), t.Ident, nil, t}
+
+				for _, variant := range t.Variants {
+					definition.Fields = append(definition.Fields, variant.Fields...)
+				}
+			default:
+				continue
+			}
+
+			definitions = append(definitions, definition)
+			fmt.Fprintf(&declarations, "struct %s;\n", definition.Ident.CType(definition.Context))
+		}
+	}
+
+	for _, definition := range orderTypes(definitions) {
+		structs.WriteString(definition.Type.CInstruction(definition.Context))
+		structs.WriteString("\n")
+	}
+
+	for _, module := range modules {
+		for _, instruction := range module.Instructions {
+			if p, ok := instruction.(Procedure); ok {
+				code.WriteString(p.Prototype(ctx.WithModule(module)))
+				code.WriteString(";\n")
+			}
+		}
+	}
+
+	for _, module := range modules {
+		for _, instruction := range module.Instructions {
+			switch instruction.(type) {
+			case Import, Struct, Enum:
+				continue
+			}
+
+			code.WriteString(instruction.CInstruction(ctx.WithModule(module)))
+			code.WriteString("\n")
+		}
+	}
+
 	writer := bufio.NewWriter(out)
+	writer.WriteString(runtime)
+	writer.WriteString("\n")
+	writer.Write(declarations.Bytes())
+	writeArrays(ctx, writer)
+	writeVecs(ctx, writer)
+	writeMaps(ctx, writer)
+	writer.Write(structs.Bytes())
+	writeAccessors(ctx, writer)
+	writeVecOperations(ctx, writer)
+	writeMapOperations(ctx, writer)
+	writer.Write(code.Bytes())
+
+	return writer.Flush()
+}
 
-	defer writer.Flush()
+// typeDeclaration is a struct or enum, which are both C structs, with the
+// context of its module. Fields are all the fields the C struct contains.
+type typeDeclaration struct {
+	Context Context
+	Ident   Path
+	Fields  []Field
+	Type    Instruction
+}
+
+// orderTypes sorts structs and enums so that every one comes after the ones
+// its fields contain, as C needs the full definition of a field's type.
+func orderTypes(types []typeDeclaration) []typeDeclaration {
+	byName := map[string]typeDeclaration{}
 
-	for {
-		node, err := nodes.Next()
+	for _, t := range types {
+		byName[t.Ident.CType(t.Context)] = t
+	}
 
-		if err != nil {
-			return err
+	var ordered []typeDeclaration
+	visited := map[string]bool{}
+
+	var visit func(t typeDeclaration)
+	visit = func(t typeDeclaration) {
+		name := t.Ident.CType(t.Context)
+
+		if visited[name] {
+			return
 		}
 
-		if node == nil {
-			break
+		visited[name] = true
+
+		for _, field := range t.Fields {
+			// arrays only point to their elements
+			if dependency, ok := byName[strings.TrimPrefix(field.Type.CType(t.Context), "struct ")]; ok {
+				visit(dependency)
+			}
 		}
 
+		ordered = append(ordered, t)
+	}
+
+	for _, t := range types {
+		visit(t)
+	}
+
+	return ordered
+}
+
+func WriteC(ctx Context, nodes []Instruction, out io.Writer) error {
+	writer := bufio.NewWriter(out)
+
+	for _, node := range nodes {
 		writer.WriteString(node.CInstruction(ctx))
 	}
 
-	return nil
+	return writer.Flush()
 }
@@ -0,0 +1,445 @@
+package codegen
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWriteModuleDeclaresFirst(t *testing.T) {
+	point := Path{Tokens: []Ident{{Name: "Point"}}}
+	line := Struct{
+		Ident:  Path{Tokens: []Ident{{Name: "Line"}}},
+		Fields: []Field{{Ident: Ident{Name: "from"}, Type: Ident{Name: "Point"}}},
+	}
+	module := Module{
+		Name: "main",
+		Instructions: []Instruction{
+			Procedure{
+				Ident:        Ident{Name: "main"},
+				ReturnType:   Int{},
+				Instructions: []Instruction{Call{Callee: Ident{Name: "helper"}}},
+			},
+			line,
+			Struct{Ident: point, Fields: []Field{{Ident: Ident{Name: "x"}, Type: Int{}}}},
+			Procedure{Ident: Ident{Name: "helper"}, ReturnType: Void{}},
+		},
+		Imports: map[string]*Module{},
+	}
+
+	var out bytes.Buffer
+
+	if err := WriteModule(Context{}, &module, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	code := out.String()
+	order := []string{"struct __whirl_main_Point {", "struct __whirl_main_Line {", "void __whirl_main_helper(void);", "int main(void) {", "void __whirl_main_helper(void) {"}
+
+	for _, declaration := range order {
+		if !strings.Contains(code, declaration) {
+			t.Fatalf("expected %q in\n%s", declaration, code)
+		}
+	}
+
+	for i := 1; i < len(order); i++ {
+		if strings.Index(code, order[i-1]) > strings.Index(code, order[i]) {
+			t.Fatalf("expected %q before %q in\n%s", order[i-1], order[i], code)
+		}
+	}
+}
+
+func TestWriteModuleArrays(t *testing.T) {
+	array := Array{Type: Int{}}
+	values := Assignment{
+		Ident: Ident{Name: "values"},
+		Type:  array,
+		Expr:  Array{Type: Int{}, Value: []Expr{Literal{Value: Int{Value: 1}}, Literal{Value: Int{Value: 2}}}},
+	}
+	module := Module{
+		Name: "main",
+		Instructions: []Instruction{
+			Procedure{
+				Ident:      Ident{Name: "main"},
+				ReturnType: Int{},
+				Instructions: []Instruction{
+					values,
+					Escape{Expr: Index{Expr: Ident{Name: "values"}, Index: Literal{Value: Int{Value: 1}}, Array: &array}},
+				},
+			},
+		},
+		Imports: map[string]*Module{},
+	}
+
+	var out bytes.Buffer
+
+	if err := WriteModule(Context{}, &module, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	code := out.String()
+	expected := []string{
+		"struct __whirl_array_int { int* data; int len; };",
+		"static inline int* __whirl_array_int_at(struct __whirl_array_int a, int i, const char* pos)",
+		"struct __whirl_array_int values = (struct __whirl_array_int) { __whirl_copy((int[]) { 1, 2 }, sizeof(int) * 2, ",
+		"return (*__whirl_array_int_at(values, 1, ",
+	}
+
+	for _, declaration := range expected {
+		if !strings.Contains(code, declaration) {
+			t.Fatalf("expected %q in\n%s", declaration, code)
+		}
+	}
+}
+
+func TestWriteModuleVecs(t *testing.T) {
+	vec := Vec{Type: Int{}}
+	values := Assignment{
+		Ident: Ident{Name: "values"},
+		Type:  vec,
+		Expr:  Vec{Type: Int{}, Value: []Expr{Literal{Value: Int{Value: 1}}}},
+	}
+	module := Module{
+		Name: "main",
+		Instructions: []Instruction{
+			Procedure{
+				Ident:      Ident{Name: "main"},
+				ReturnType: Int{},
+				Instructions: []Instruction{
+					values,
+					Discard{Expr: VecCall{Vec: vec, Name: "push", Args: []Expr{Ident{Name: "values"}, Literal{Value: Int{Value: 2}}}}},
+					Escape{Expr: Index{Expr: Ident{Name: "values"}, Index: Literal{Value: Int{Value: 1}}, Vec: &vec}},
+				},
+			},
+		},
+		Imports: map[string]*Module{},
+	}
+
+	var out bytes.Buffer
+
+	if err := WriteModule(Context{}, &module, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	code := out.String()
+	expected := []string{
+		"struct __whirl_vec_int { int* data; int len; int cap; };",
+		"static inline void __whirl_vec_int_push(struct __whirl_vec_int* v, int value, const char* pos)",
+		"static inline int __whirl_vec_int_pop(struct __whirl_vec_int* v, const char* pos)",
+		"struct __whirl_vec_int* values = __whirl_vec_int_new((int[]) { 1 }, 1, ",
+		"__whirl_vec_int_push(values, 2, ",
+		"return (*__whirl_vec_int_at(values, 1, ",
+	}
+
+	for _, declaration := range expected {
+		if !strings.Contains(code, declaration) {
+			t.Fatalf("expected %q in\n%s", declaration, code)
+		}
+	}
+}
+
+func TestWriteModuleVecIterPop(t *testing.T) {
+	vec := Vec{Type: Int{}}
+	module := Module{
+		Name: "main",
+		Instructions: []Instruction{
+			Procedure{
+				Ident:      Ident{Name: "main"},
+				ReturnType: Int{},
+				Instructions: []Instruction{
+					Assignment{Ident: Ident{Name: "values"}, Type: vec, Expr: Vec{Type: Int{}, Value: []Expr{Literal{Value: Int{Value: 1}}, Literal{Value: Int{Value: 2}}}}},
+					Iter{
+						Ident:    Ident{Name: "x"},
+						Iterable: Ident{Name: "values"},
+						Type:     vec,
+						Body:     []Instruction{Discard{Expr: VecCall{Vec: vec, Name: "pop", Args: []Expr{Ident{Name: "values"}}}}},
+					},
+					Escape{Expr: Literal{Value: Int{Value: 0}}},
+				},
+			},
+		},
+		Imports: map[string]*Module{},
+	}
+
+	var out bytes.Buffer
+
+	if err := WriteModule(Context{}, &module, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	code := out.String()
+	loop := "for (int __whirl_index = 0; __whirl_index < __whirl_iterable->len; __whirl_index++) { "
+
+	if !strings.Contains(code, loop) {
+		t.Fatalf("expected the length to be read on every iteration in\n%s", code)
+	}
+
+	if strings.Contains(code, "__whirl_length") {
+		t.Fatalf("expected the length not to be read before the loop in\n%s", code)
+	}
+
+	if strings.Index(code, loop) > strings.Index(code, "__whirl_vec_int_pop(values, ") {
+		t.Fatalf("expected the pop inside the loop in\n%s", code)
+	}
+}
+
+func TestWriteModuleMaps(t *testing.T) {
+	m := Map{Key: String{}, Value: Int{}}
+	counts := Assignment{
+		Ident: Ident{Name: "counts"},
+		Type:  m,
+		Expr:  Map{Key: String{}, Value: Int{}, Keys: []Expr{Literal{Value: String{Value: "a"}}}, Values: []Expr{Literal{Value: Int{Value: 1}}}},
+	}
+	module := Module{
+		Name: "main",
+		Instructions: []Instruction{
+			Procedure{
+				Ident:      Ident{Name: "main"},
+				ReturnType: Int{},
+				Instructions: []Instruction{
+					counts,
+					Iter{Index: &Ident{Name: "word"}, Ident: Ident{Name: "n"}, Iterable: Ident{Name: "counts"}, Type: m},
+					Escape{Expr: MapCall{Map: m, Name: "get", Args: []Expr{Ident{Name: "counts"}, Literal{Value: String{Value: "a"}}}}},
+				},
+			},
+		},
+		Imports: map[string]*Module{},
+	}
+
+	var out bytes.Buffer
+
+	if err := WriteModule(Context{}, &module, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	code := out.String()
+	expected := []string{
+		"struct __whirl_map___whirl_string__int { struct __whirl_string* keys; int* values; char* alive; int len; int count; int cap; int* index; int buckets; int iterating; };",
+		"static inline unsigned long long __whirl_hash___whirl_string(struct __whirl_string k)",
+		"static inline int __whirl_eq___whirl_string(struct __whirl_string a, struct __whirl_string b) { return __whirl_string_eq(a, b); }",
+		"struct __whirl_map___whirl_string__int* counts = __whirl_map___whirl_string__int_new((struct __whirl_string[]) { ((struct __whirl_string) { \"a\", sizeof(\"a\") - 1 }) }, (int[]) { 1 }, 1, ",
+		"struct __whirl_string word = __whirl_iterable->keys[__whirl_index];",
+		"int n = __whirl_iterable->values[__whirl_index];",
+		"return __whirl_map___whirl_string__int_get(counts, ((struct __whirl_string) { \"a\", sizeof(\"a\") - 1 }), ",
+	}
+
+	for _, declaration := range expected {
+		if !strings.Contains(code, declaration) {
+			t.Fatalf("expected %q in\n%s", declaration, code)
+		}
+	}
+}
+
+func TestWriteModuleMapIterInsert(t *testing.T) {
+	m := Map{Key: Int{}, Value: Int{}}
+	module := Module{
+		Name: "main",
+		Instructions: []Instruction{
+			Procedure{
+				Ident:      Ident{Name: "main"},
+				ReturnType: Int{},
+				Instructions: []Instruction{
+					Assignment{Ident: Ident{Name: "m"}, Type: m, Expr: Map{Key: Int{}, Value: Int{}}},
+					Iter{
+						Ident:    Ident{Name: "k"},
+						Iterable: Ident{Name: "m"},
+						Type:     m,
+						Body: []Instruction{
+							Discard{Expr: MapCall{Map: m, Name: "insert", Args: []Expr{Ident{Name: "m"}, Ident{Name: "k"}, Ident{Name: "k"}}}},
+							Escape{Expr: Ident{Name: "k"}},
+						},
+					},
+					Escape{Expr: Literal{Value: Int{Value: 0}}},
+				},
+			},
+		},
+		Imports: map[string]*Module{},
+	}
+
+	var out bytes.Buffer
+
+	if err := WriteModule(Context{}, &module, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	code := out.String()
+	expected := []string{
+		"if (!m->iterating) { int count = 0; ",
+		"struct __whirl_map_int__int* __whirl_iterating0 = __whirl_iterable; __whirl_iterating0->iterating++; for (",
+		"__whirl_iterating0->iterating--; return k; } __whirl_iterating0->iterating--; } return 0; }",
+	}
+
+	for _, declaration := range expected {
+		if !strings.Contains(code, declaration) {
+			t.Fatalf("expected %q in\n%s", declaration, code)
+		}
+	}
+}
+
+func TestWriteModuleStrings(t *testing.T) {
+	greeting := Literal{Value: String{Value: "hi"}}
+	module := Module{
+		Name: "main",
+		Instructions: []Instruction{
+			Procedure{
+				Ident:      Ident{Name: "main"},
+				ReturnType: Int{},
+				Instructions: []Instruction{
+					Assignment{Ident: Ident{Name: "s"}, Type: String{}, Expr: RuntimeCall{Name: "__whirl_string_concat", Args: []Expr{greeting, greeting}, Position: true}},
+					Call{Callee: Ident{Name: "printf"}, Args: []Expr{CString{Expr: Literal{Value: String{Value: "%s"}}}, CString{Expr: Ident{Name: "s"}}}},
+					Escape{Expr: FieldAccess{Expr: Ident{Name: "s"}, Field: Ident{Name: "len"}}},
+				},
+			},
+		},
+		Imports: map[string]*Module{},
+	}
+
+	var out bytes.Buffer
+
+	if err := WriteModule(Context{}, &module, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	code := out.String()
+	expected := []string{
+		"struct __whirl_string { const char* data; int len; };",
+		"struct __whirl_string s = __whirl_string_concat(((struct __whirl_string) { \"hi\", sizeof(\"hi\") - 1 }), ((struct __whirl_string) { \"hi\", sizeof(\"hi\") - 1 }), ",
+		"printf(\"%s\", s.data);",
+		"return s.len;",
+	}
+
+	for _, declaration := range expected {
+		if !strings.Contains(code, declaration) {
+			t.Fatalf("expected %q in\n%s", declaration, code)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	quoted := map[string]string{
+		"say \"hi\"\n": `"say \"hi\"\n"`,
+		"a\\b\tc\x00d": `"a\\b\tc\000d"`,
+		"\u00e9":       `"\303\251"`,
+		"what??!":      `"what?\?!"`,
+	}
+
+	for value, expected := range quoted {
+		if got := quote(value); got != expected {
+			t.Fatalf("expected %s, got %s", expected, got)
+		}
+	}
+
+	if got := (Char{Value: '\''}).CValue(Context{}); got != `'\''` {
+		t.Fatalf(`expected '\'', got %s`, got)
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	types := map[Type]string{
+		Int{}:                        "int",
+		Int{Bits: 64}:                "int64_t",
+		Int{Bits: 8, Unsigned: true}: "uint8_t",
+		Float{}:                      "double",
+		Float{Bits: 32}:              "float",
+	}
+
+	for typ, expected := range types {
+		if got := typ.CType(Context{}); got != expected {
+			t.Fatalf("expected %s, got %s", expected, got)
+		}
+	}
+
+	values := map[float64]string{2: "2.0", 0.25: "0.25", 1e100: "1e+100"}
+
+	for value, expected := range values {
+		if got := (Float{Value: value}).CValue(Context{}); got != expected {
+			t.Fatalf("expected %s, got %s", expected, got)
+		}
+	}
+
+	if got := (Int{Value: math.MaxUint64}).CValue(Context{}); got != "18446744073709551615ull" {
+		t.Fatalf("expected 18446744073709551615ull, got %s", got)
+	}
+
+	if got := (Cast{Expr: Literal{Value: Int{Value: 1}}, Type: Float{}}).CValue(Context{}); got != "((double) 1)" {
+		t.Fatalf("expected ((double) 1), got %s", got)
+	}
+}
+
+func TestWriteModuleKeywords(t *testing.T) {
+	module := Module{
+		Name: "main",
+		Instructions: []Instruction{
+			Struct{Ident: Path{Tokens: []Ident{{Name: "double"}}}, Fields: []Field{{Ident: Ident{Name: "long"}, Type: Int{}}}},
+			Procedure{
+				Ident:      Ident{Name: "main"},
+				ReturnType: Int{},
+				Instructions: []Instruction{
+					Assignment{Ident: Ident{Name: "float"}, Type: Float{}, Expr: Literal{Value: Float{Value: 1.5}}},
+					Escape{Expr: FieldAccess{Expr: StructInit{Path: Path{Tokens: []Ident{{Name: "double"}}}, Fields: []FieldInit{{Ident: Ident{Name: "long"}, Expr: Ident{Name: "float"}}}}, Field: Ident{Name: "long"}}},
+				},
+			},
+		},
+		Imports: map[string]*Module{},
+	}
+
+	var out bytes.Buffer
+
+	if err := WriteModule(Context{}, &module, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	code := out.String()
+	expected := []string{
+		"struct __whirl_main_double { int __whirl_long;  };",
+		"double __whirl_float = 1.5;",
+		"return (struct __whirl_main_double) { .__whirl_long = __whirl_float }.__whirl_long;",
+	}
+
+	for _, declaration := range expected {
+		if !strings.Contains(code, declaration) {
+			t.Fatalf("expected %q in\n%s", declaration, code)
+		}
+	}
+}
+
+func TestWriteModuleLibraryNames(t *testing.T) {
+	module := Module{
+		Name: "main",
+		Instructions: []Instruction{
+			Struct{Ident: Path{Tokens: []Ident{{Name: "FILE"}}}, Fields: []Field{{Ident: Ident{Name: "n"}, Type: Int{}}}},
+			Procedure{
+				Ident:        Ident{Name: "free"},
+				Args:         []Argument{{Ident: Ident{Name: "n"}, Type: Int{}}},
+				ReturnType:   Int{},
+				Instructions: []Instruction{Escape{Expr: Ident{Name: "n"}}},
+			},
+			Procedure{
+				Ident:        Ident{Name: "main"},
+				ReturnType:   Int{},
+				Instructions: []Instruction{Escape{Expr: Call{Callee: Ident{Name: "free"}, Args: []Expr{Literal{Value: Int{Value: 0}}}}}},
+			},
+		},
+		Imports: map[string]*Module{},
+	}
+
+	var out bytes.Buffer
+
+	if err := WriteModule(Context{}, &module, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	code := out.String()
+	expected := []string{
+		"struct __whirl_main_FILE { int n;  };",
+		"int __whirl_main_free(int n) {",
+		"int main(void) { return __whirl_main_free(0); }",
+	}
+
+	for _, declaration := range expected {
+		if !strings.Contains(code, declaration) {
+			t.Fatalf("expected %q in\n%s", declaration, code)
+		}
+	}
+}
@@ -15,127 +15,375 @@ type Value interface {
 }
 
 type Procedure struct {
-	Ident        Ident
+	Ident Ident
+	// Receiver is the struct a method is declared on, nil for procedures.
+	Receiver     *Ident
 	Args         []Argument
 	Instructions []Instruction
 	ReturnType   Type
+	Span         lexer.Span
 }
 
 type Argument struct {
 	Ident Ident
 	Type  Type
-}
-
-type ProcedureCall struct {
-	Ident Path
-	Args  []Expr
+	Span  lexer.Span
 }
 
 type Struct struct {
 	Ident  Path
 	Fields []Field
+	Span   lexer.Span
 }
 
-type StructInit struct {
+// Enum is a type whose values are one of its variants, each of which can
+// carry fields.
+type Enum struct {
+	Ident    Path
+	Variants []Variant
+	Span     lexer.Span
+}
+
+type Variant struct {
 	Ident  Ident
+	Fields []Field
+	Span   lexer.Span
+}
+
+// VariantInit creates a value of an enum, with the fields of the variant in
+// order. It is built by the checker from calls and paths naming variants.
+type VariantInit struct {
+	// Type is the enum.
+	Type    Type
+	Variant Ident
+	// Tag is the index of the variant in the enum.
+	Tag  int
+	Args []Expr
+	Span lexer.Span
+}
+
+// Match runs the first arm whose pattern matches the value of Expr. Used as
+// an expression, the arms are values and the match is the value of the arm
+// that runs.
+type Match struct {
+	Expr Expr
+	Arms []MatchArm
+	// Type is the type of Expr and Result the type of the arms' values,
+	// both set by the checker. Result is nil if the match is an instruction.
+	Type   Type
+	Result Type
+	Span   lexer.Span
+}
+
+// MatchArm runs Body, or evaluates Value if it is a single expression.
+type MatchArm struct {
+	Pattern Pattern
+	Body    []Instruction
+	Value   Expr
+	Span    lexer.Span
+}
+
+// Pattern matches a variant of an enum, binding its fields to the names in
+// Bindings. A pattern without a variant is _, which matches anything.
+type Pattern struct {
+	Variant  *Path
+	Bindings []Ident
+	// Tag and Fields are those of the variant, set by the checker.
+	Tag    int
+	Fields []Field
+	Span   lexer.Span
+}
+
+// StructInit is a struct value like Point { x: 1, y: 2, }. Path names the
+// struct, which may be declared in an imported module.
+type StructInit struct {
+	Path   Path
 	Fields []FieldInit
+	Span   lexer.Span
 }
 
 type Field struct {
 	Ident Ident
 	Type  Type
+	Span  lexer.Span
 }
 
 type FieldInit struct {
 	Ident Ident
 	Expr  Expr
+	Span  lexer.Span
 }
 
 type If struct {
 	Condition Expr
 	Body      []Instruction
 	Else      []Instruction
+	Span      lexer.Span
 }
 
 type Expr interface {
 	CValue(ctx Context) string
 }
 
-type ExprMath struct {
-	Tokens []Expr
+// Binary is an infix operation. Op is the lexer kind of the operator.
+type Binary struct {
+	Op    int
+	Left  Expr
+	Right Expr
+	Span  lexer.Span
+}
+
+// Unary is a prefix operation. Op is the lexer kind of the operator.
+type Unary struct {
+	Op   int
+	Expr Expr
+	Span lexer.Span
+}
+
+// Cast converts the value of Expr to Type, written expr as Type.
+type Cast struct {
+	Expr Expr
+	Type Type
+	Span lexer.Span
+}
+
+// AddressOf takes a reference to the variable, field or element Expr refers
+// to, through which it can be changed if Mutable is set.
+type AddressOf struct {
+	Expr    Expr
+	Mutable bool
+	Span    lexer.Span
+}
+
+// Deref is the value the reference Expr refers to. The checker also inserts
+// it where references are seen through, like field accesses.
+type Deref struct {
+	Expr Expr
+	Span lexer.Span
+}
+
+// Method is the callee of a call to a method of a struct. It is built by the
+// checker, which passes the value the method is called on as the first
+// argument.
+type Method struct {
+	// Namespace is the namespace of the module declaring the struct.
+	Namespace string
+	Receiver  string
+	Ident     Ident
+	Span      lexer.Span
+}
+
+type Call struct {
+	Callee Expr
+	Args   []Expr
+	Span   lexer.Span
+}
+
+type Index struct {
+	Expr  Expr
+	Index Expr
+	// Array or Vec is the type of the indexed value, set by the checker.
+	Array *Array
+	Vec   *Vec
+	Span  lexer.Span
+}
+
+// RuntimeCall calls a procedure of the C runtime, whose name isn't mangled.
+type RuntimeCall struct {
+	Name string
+	Args []Expr
+	// Position passes the position of the call last, for runtime errors.
+	Position bool
+	Span     lexer.Span
+}
+
+// CString is the characters of a string, followed by a NUL, for procedures
+// of C like printf.
+type CString struct {
+	Expr Expr
+	Span lexer.Span
 }
 
-type ExprToken struct {
-	Token lexer.Token
+type FieldAccess struct {
+	Expr  Expr
+	Field Ident
+	Span  lexer.Span
+}
+
+// Literal is a constant Int, Float, String, Bool or Char value.
+type Literal struct {
+	Value Value
+	Span  lexer.Span
 }
 
 type Assignment struct {
 	Ident Ident
 	Expr  Expr
 	Type  Type
-}
-
-type FunctionCall struct {
-	Ident Path
-	Args  []Expr
+	Span  lexer.Span
 }
 
 type Escape struct {
 	Expr Expr
+	Span lexer.Span
 }
 
 type Array struct {
 	Type  Type
 	Value []Expr
+	Span  lexer.Span
+}
+
+// Reference is the type of references to values of Type, written &Type or
+// &mut Type.
+type Reference struct {
+	Type    Type
+	Mutable bool
+	Span    lexer.Span
+}
+
+// Vec is a growable vector of values of Type, which lives on the heap and is
+// shared by its copies. The checker turns array literals into vectors where
+// one is expected, with the elements in Value.
+type Vec struct {
+	Type  Type
+	Value []Expr
+	Span  lexer.Span
+}
+
+// VecCall calls an operation of the runtime of a vector type, push or pop,
+// with the vector as the first argument.
+type VecCall struct {
+	Vec  Vec
+	Name string
+	Args []Expr
+	Span lexer.Span
+}
+
+// Map is a hash map from values of Key to values of Value, which lives on the
+// heap and is shared by its copies. Keys and Values hold the entries of a
+// literal, whose types are set by the checker.
+type Map struct {
+	Key    Type
+	Value  Type
+	Keys   []Expr
+	Values []Expr
+	Span   lexer.Span
+}
+
+// MapCall calls an operation of the runtime of a map type, like insert, with
+// the map as the first argument.
+type MapCall struct {
+	Map  Map
+	Name string
+	Args []Expr
+	Span lexer.Span
 }
 
+// Int is an integer. Bits is 8, 16, 32 or 64 for the types of a given size,
+// like i8 or u64, and 0 for int, which is as big as an int of C. The Value of
+// a literal is never negative, as - is an operator, and can be as large as
+// the largest u64.
 type Int struct {
-	Value int64
+	Value    uint64
+	Bits     int
+	Unsigned bool
+	Span     lexer.Span
+}
+
+// Float is a floating point number. Bits is 32 for f32, 64 for f64 and 0
+// for float, which is as big as f64.
+type Float struct {
+	Value float64
+	Bits  int
+	Span  lexer.Span
 }
 
 type String struct {
 	Value string
+	Span  lexer.Span
 }
 
 type Bool struct {
 	Value bool
+	Span  lexer.Span
 }
 
-type Void struct{}
+type Void struct {
+	Span lexer.Span
+}
 
 type Char struct {
 	Value rune
+	Span  lexer.Span
 }
 
 type Ident struct {
 	Name string
+	Span lexer.Span
 }
 
+// Iter loops over the elements of an array or a vector, the characters of a
+// string, the numbers of a range or the entries of a map.
 type Iter struct {
-	Ident Ident
-	Lower Expr
-	Upper Expr
-	Body  []Instruction
+	// Index is the variable counting the iterations, or the key of a map,
+	// if there is one.
+	Index    *Ident
+	Ident    Ident
+	Iterable Expr
+	// Type is the type of Iterable, set by the checker.
+	Type Type
+	Body []Instruction
+	Span lexer.Span
+}
+
+// Range is the numbers from Lower up to Upper, which is only included if
+// Inclusive is set, counting by Step, or by 1 if Step is nil. It is both a
+// value and, with no bounds, the type of ranges.
+type Range struct {
+	Lower     Expr
+	Upper     Expr
+	Step      Expr
+	Inclusive bool
+	Span      lexer.Span
 }
 
 type Until struct {
 	Condition Expr
 	Body      []Instruction
+	Span      lexer.Span
 }
 
 type Reassign struct {
-	Ident Path
-	Expr  Expr
+	Target Expr
+	Expr   Expr
+	Span   lexer.Span
 }
 
-type Break struct{}
+// Discard evaluates an expression for its side effects, for builtin calls
+// that are lowered to other expressions.
+type Discard struct {
+	Expr Expr
+	Span lexer.Span
+}
 
-type Continue struct{}
+type Break struct {
+	Span lexer.Span
+}
+
+type Continue struct {
+	Span lexer.Span
+}
 
 type Import struct {
 	Path string
+	Span lexer.Span
+
+	// Module is the loaded module, set once the import is resolved.
+	Module *Module
 }
 
 type Path struct {
 	Tokens []Ident
+	Span   lexer.Span
 }
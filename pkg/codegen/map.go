@@ -0,0 +1,237 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// mapPrefix prefixes the C names of the structs maps are lowered to and of
+// their operations.
+const mapPrefix = "__whirl_map_"
+
+// keyName returns the part of the C names of the hash and equality functions
+// of a key type that identifies it.
+func keyName(ctx Context, typ Type) string {
+	return PathToNamespace(strings.TrimPrefix(typ.CType(ctx), "struct "))
+}
+
+// name returns the C name of the struct of the map type, recording it in the
+// context to be declared by writeMaps.
+func (m Map) name(ctx Context) string {
+	name := mapPrefix + keyName(ctx, m.Key) + "__" + keyName(ctx, m.Value)
+
+	if ctx.maps != nil {
+		ctx.maps[name] = Map{Key: m.Key, Value: m.Value}
+	}
+
+	return name
+}
+
+// CType is a pointer to a struct holding the entries in the order they were
+// inserted and an index of open addressed slots pointing to them, so that
+// inserting through one copy of a map is seen by all.
+func (m Map) CType(ctx Context) string {
+	return "struct " + m.name(ctx) + "*"
+}
+
+// CValue creates a map with the entries of the literal.
+func (m Map) CValue(ctx Context) string {
+	name := m.name(ctx)
+
+	if len(m.Keys) == 0 {
+		return fmt.Sprintf("%s_new(NULL, NULL, 0, %s)", name, position(m.Span))
+	}
+
+	return fmt.Sprintf("%s_new((%s[]) { %s }, (%s[]) { %s }, %d, %s)",
+		name, m.Key.CType(ctx), values(ctx, m.Keys), m.Value.CType(ctx), values(ctx, m.Values), len(m.Keys), position(m.Span))
+}
+
+func (m MapCall) CValue(ctx Context) string {
+	return operation(ctx, m.Map.name(ctx)+"_"+m.Name, m.Args, m.Span)
+}
+
+// values returns a comma separated list of the C values of exprs.
+func values(ctx Context, exprs []Expr) string {
+	var buffer bytes.Buffer
+
+	for i, expr := range exprs {
+		buffer.WriteString(expr.CValue(ctx))
+
+		if i != len(exprs)-1 {
+			buffer.WriteString(", ")
+		}
+	}
+
+	return buffer.String()
+}
+
+// writeMaps writes the structs of the map types recorded in the context.
+// Removed entries stay in place, marked as not alive, until the entries are
+// compacted when they run out of room, unless iterating counts loops going
+// over them, which compacting would make skip entries. An index slot is -1
+// if it is empty and -2 if its entry was removed.
+func writeMaps(ctx Context, out io.Writer) {
+	for _, name := range mapNames(ctx) {
+		m := ctx.maps[name]
+
+		fmt.Fprintf(out, "struct %s { %s* keys; %s* values; char* alive; int len; int count; int cap; int* index; int buckets; int iterating; };\n",
+			name, m.Key.CType(ctx), m.Value.CType(ctx))
+	}
+}
+
+// writeMapOperations writes the hash and equality functions of the key types
+// and the operations of the map types recorded in the context.
+func writeMapOperations(ctx Context, out io.Writer) {
+	names := mapNames(ctx)
+
+	if len(names) == 0 {
+		return
+	}
+
+	keys := map[string]Type{}
+
+	for _, name := range names {
+		addKey(ctx, keys, ctx.maps[name].Key)
+	}
+
+	writeKeyFunctions(ctx, keys, out)
+
+	for _, name := range names {
+		writeMapOperation(ctx, name, ctx.maps[name], out)
+	}
+}
+
+// addKey records a key type and the types of its fields, which are hashed
+// and compared to hash and compare it.
+func addKey(ctx Context, keys map[string]Type, typ Type) {
+	name := keyName(ctx, typ)
+
+	if _, ok := keys[name]; ok {
+		return
+	}
+
+	keys[name] = typ
+
+	for _, field := range ctx.structs[name] {
+		addKey(ctx, keys, field.Type)
+	}
+}
+
+// writeKeyFunctions writes the hash and equality functions of the key types.
+// Their prototypes come first, as a struct key uses those of its fields.
+func writeKeyFunctions(ctx Context, keys map[string]Type, out io.Writer) {
+	names := make([]string, 0, len(keys))
+
+	for name := range keys {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		typ := keys[name].CType(ctx)
+
+		fmt.Fprintf(out, "static inline unsigned long long __whirl_hash_%s(%s k);\n", name, typ)
+		fmt.Fprintf(out, "static inline int __whirl_eq_%s(%s a, %s b);\n", name, typ, typ)
+	}
+
+	for _, name := range names {
+		typ := keys[name].CType(ctx)
+
+		fmt.Fprintf(out, "static inline unsigned long long __whirl_hash_%s(%s k) { ", name, typ)
+
+		switch keys[name].(type) {
+		case String:
+			io.WriteString(out, "unsigned long long h = 14695981039346656037ull; for (int i = 0; i < k.len; i++) h = (h ^ (unsigned char) k.data[i]) * 1099511628211ull; return h; }\n")
+			fmt.Fprintf(out, "static inline int __whirl_eq_%s(%s a, %s b) { return __whirl_string_eq(a, b); }\n", name, typ, typ)
+		case Int, Char, Bool:
+			io.WriteString(out, "unsigned long long h = (unsigned long long) k * 11400714819323198485ull; return h ^ (h >> 29); }\n")
+			fmt.Fprintf(out, "static inline int __whirl_eq_%s(%s a, %s b) { return a == b; }\n", name, typ, typ)
+		default:
+			fields := ctx.structs[name]
+
+			io.WriteString(out, "unsigned long long h = 17; ")
+
+			for _, field := range fields {
+				fmt.Fprintf(out, "h = h * 31 + __whirl_hash_%s(k.%s); ", keyName(ctx, field.Type), cName(field.Ident.Name))
+			}
+
+			io.WriteString(out, "return h; }\n")
+			fmt.Fprintf(out, "static inline int __whirl_eq_%s(%s a, %s b) { return 1", name, typ, typ)
+
+			for _, field := range fields {
+				fmt.Fprintf(out, " && __whirl_eq_%s(a.%s, b.%s)", keyName(ctx, field.Type), cName(field.Ident.Name), cName(field.Ident.Name))
+			}
+
+			io.WriteString(out, "; }\n")
+		}
+	}
+}
+
+// writeMapOperation writes the operations of a map type. find returns the
+// index slot of a key, or -1 if it isn't in the map. rehash compacts the
+// entries unless a loop goes over them, grows them if more than half are
+// still taken, and rebuilds the index with twice as many slots as there is
+// room for entries.
+func writeMapOperation(ctx Context, name string, m Map, out io.Writer) {
+	key := m.Key.CType(ctx)
+	value := m.Value.CType(ctx)
+	hash := "__whirl_hash_" + keyName(ctx, m.Key)
+	eq := "__whirl_eq_" + keyName(ctx, m.Key)
+
+	fmt.Fprintf(out, "static inline int %s_find(struct %s* m, %s key) { ", name, name, key)
+	io.WriteString(out, "if (m->buckets == 0) return -1; ")
+	fmt.Fprintf(out, "for (unsigned long long h = %s(key) & (m->buckets - 1);; h = (h + 1) & (m->buckets - 1)) { ", hash)
+	io.WriteString(out, "int entry = m->index[h]; if (entry == -1) return -1; ")
+	fmt.Fprintf(out, "if (entry >= 0 && %s(m->keys[entry], key)) return (int) h; } }\n", eq)
+
+	fmt.Fprintf(out, "static inline void %s_rehash(struct %s* m, const char* pos) { ", name, name)
+	io.WriteString(out, "if (!m->iterating) { int count = 0; ")
+	io.WriteString(out, "for (int i = 0; i < m->count; i++) { if (!m->alive[i]) continue; m->keys[count] = m->keys[i]; m->values[count] = m->values[i]; m->alive[count] = 1; count++; } ")
+	io.WriteString(out, "m->count = count; } ")
+	io.WriteString(out, "if (m->count * 2 >= m->cap) { m->cap = m->cap ? m->cap * 2 : 4; ")
+	io.WriteString(out, "m->keys = __whirl_alloc(m->keys, sizeof(*m->keys) * m->cap, pos); m->values = __whirl_alloc(m->values, sizeof(*m->values) * m->cap, pos); m->alive = __whirl_alloc(m->alive, m->cap, pos); } ")
+	io.WriteString(out, "m->buckets = m->cap * 2; m->index = __whirl_alloc(m->index, sizeof(int) * m->buckets, pos); ")
+	io.WriteString(out, "for (int i = 0; i < m->buckets; i++) m->index[i] = -1; ")
+	fmt.Fprintf(out, "for (int i = 0; i < m->count; i++) { if (!m->alive[i]) continue; unsigned long long h = %s(m->keys[i]) & (m->buckets - 1); ", hash)
+	io.WriteString(out, "while (m->index[h] != -1) h = (h + 1) & (m->buckets - 1); m->index[h] = i; } }\n")
+
+	fmt.Fprintf(out, "static inline void %s_insert(struct %s* m, %s key, %s value, const char* pos) { ", name, name, key, value)
+	fmt.Fprintf(out, "int slot = %s_find(m, key); if (slot >= 0) { m->values[m->index[slot]] = value; return; } ", name)
+	fmt.Fprintf(out, "if (m->count == m->cap) %s_rehash(m, pos); ", name)
+	fmt.Fprintf(out, "unsigned long long h = %s(key) & (m->buckets - 1); while (m->index[h] >= 0) h = (h + 1) & (m->buckets - 1); ", hash)
+	io.WriteString(out, "m->index[h] = m->count; m->keys[m->count] = key; m->values[m->count] = value; m->alive[m->count] = 1; m->count++; m->len++; }\n")
+
+	fmt.Fprintf(out, "static inline %s %s_get(struct %s* m, %s key, const char* pos) { ", value, name, name, key)
+	fmt.Fprintf(out, "int slot = %s_find(m, key); ", name)
+	io.WriteString(out, `if (slot < 0) __whirl_panic(pos, "the key is not in the map"); `)
+	io.WriteString(out, "return m->values[m->index[slot]]; }\n")
+
+	fmt.Fprintf(out, "static inline int %s_contains(struct %s* m, %s key, const char* pos) { ", name, name, key)
+	fmt.Fprintf(out, "(void) pos; return %s_find(m, key) >= 0; }\n", name)
+
+	fmt.Fprintf(out, "static inline int %s_remove(struct %s* m, %s key, const char* pos) { ", name, name, key)
+	fmt.Fprintf(out, "(void) pos; int slot = %s_find(m, key); if (slot < 0) return 0; ", name)
+	io.WriteString(out, "m->alive[m->index[slot]] = 0; m->index[slot] = -2; m->len--; return 1; }\n")
+
+	fmt.Fprintf(out, "static inline struct %s* %s_new(%s* keys, %s* values, int len, const char* pos) { ", name, name, key, value)
+	fmt.Fprintf(out, "struct %s* m = __whirl_alloc(NULL, sizeof(struct %s), pos); ", name, name)
+	io.WriteString(out, "m->keys = NULL; m->values = NULL; m->alive = NULL; m->index = NULL; m->len = 0; m->count = 0; m->cap = 0; m->buckets = 0; m->iterating = 0; ")
+	fmt.Fprintf(out, "for (int i = 0; i < len; i++) %s_insert(m, keys[i], values[i], pos); ", name)
+	io.WriteString(out, "return m; }\n")
+}
+
+func mapNames(ctx Context) []string {
+	names := make([]string, 0, len(ctx.maps))
+
+	for name := range ctx.maps {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,243 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/whirl-lang/whirl/pkg/lexer"
+)
+
+// runtime is the C code every program starts with.
+const runtime = `#include <errno.h>
+#include <limits.h>
+#include <stdarg.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+struct __whirl_range { int lower; int upper; int step; int inclusive; };
+struct __whirl_string { const char* data; int len; };
+
+static inline void __whirl_panic(const char* pos, const char* format, ...) {
+	va_list args;
+	fflush(stdout);
+	fprintf(stderr, "panic at %s: ", pos);
+	va_start(args, format);
+	vfprintf(stderr, format, args);
+	va_end(args);
+	fprintf(stderr, "\n");
+	exit(101);
+}
+
+static inline void* __whirl_alloc(void* data, size_t size, const char* pos) {
+	data = realloc(data, size);
+	if (data == NULL) __whirl_panic(pos, "out of memory");
+	return data;
+}
+
+static inline void* __whirl_copy(const void* data, size_t size, const char* pos) {
+	void* copy = __whirl_alloc(NULL, size, pos);
+	memcpy(copy, data, size);
+	return copy;
+}
+
+static inline struct __whirl_string __whirl_string_c(const char* s) {
+	return (struct __whirl_string) { s, (int) strlen(s) };
+}
+
+static inline struct __whirl_string __whirl_string_new(const char* data, int len, const char* pos) {
+	char* copy = __whirl_alloc(NULL, (size_t) len + 1, pos);
+	memcpy(copy, data, len);
+	copy[len] = '\0';
+	return (struct __whirl_string) { copy, len };
+}
+
+static inline struct __whirl_string __whirl_string_concat(struct __whirl_string a, struct __whirl_string b, const char* pos) {
+	char* data = __whirl_alloc(NULL, (size_t) a.len + b.len + 1, pos);
+	memcpy(data, a.data, a.len);
+	memcpy(data + a.len, b.data, b.len);
+	data[a.len + b.len] = '\0';
+	return (struct __whirl_string) { data, a.len + b.len };
+}
+
+static inline int __whirl_string_eq(struct __whirl_string a, struct __whirl_string b) {
+	return a.len == b.len && memcmp(a.data, b.data, a.len) == 0;
+}
+
+static inline int __whirl_string_cmp(struct __whirl_string a, struct __whirl_string b) {
+	int c = memcmp(a.data, b.data, a.len < b.len ? a.len : b.len);
+	if (c != 0) return c;
+	return a.len - b.len;
+}
+
+static inline char __whirl_string_at(struct __whirl_string s, int i, const char* pos) {
+	if (i < 0 || i >= s.len) __whirl_panic(pos, "index %d out of bounds for length %d", i, s.len);
+	return s.data[i];
+}
+
+static inline struct __whirl_string __whirl_string_slice(struct __whirl_string s, int lower, int upper, const char* pos) {
+	if (lower < 0 || upper > s.len || lower > upper) __whirl_panic(pos, "slice %d:%d out of bounds for length %d", lower, upper, s.len);
+	return __whirl_string_new(s.data + lower, upper - lower, pos);
+}
+
+static inline struct __whirl_string __whirl_string_from_int(long long n, const char* pos) {
+	char buffer[24];
+	return __whirl_string_new(buffer, snprintf(buffer, sizeof(buffer), "%lld", n), pos);
+}
+
+static inline struct __whirl_string __whirl_string_from_uint(unsigned long long n, const char* pos) {
+	char buffer[24];
+	return __whirl_string_new(buffer, snprintf(buffer, sizeof(buffer), "%llu", n), pos);
+}
+
+static inline struct __whirl_string __whirl_string_from_float(double n, const char* pos) {
+	char buffer[32];
+	return __whirl_string_new(buffer, snprintf(buffer, sizeof(buffer), "%g", n), pos);
+}
+
+static inline struct __whirl_string __whirl_string_from_char(char c, const char* pos) {
+	return __whirl_string_new(&c, 1, pos);
+}
+
+static inline int __whirl_string_to_int(struct __whirl_string s, const char* pos) {
+	char* end;
+	long n;
+	errno = 0;
+	n = strtol(s.data, &end, 10);
+	if (s.len == 0 || (s.data[0] != '-' && s.data[0] != '+' && (s.data[0] < '0' || s.data[0] > '9')) || end != s.data + s.len || errno == ERANGE || n < INT_MIN || n > INT_MAX) {
+		__whirl_panic(pos, "cannot parse \"%s\" as an int", s.data);
+	}
+	return (int) n;
+}
+
+static inline int __whirl_range_len(struct __whirl_range r, const char* pos) {
+	if (r.step == 0) __whirl_panic(pos, "the step of a range cannot be 0");
+	long distance = r.step > 0 ? (long) r.upper - r.lower : (long) r.lower - r.upper;
+	long step = r.step > 0 ? r.step : -(long) r.step;
+	if (distance < 0 || (distance == 0 && !r.inclusive)) return 0;
+	if (r.inclusive) return distance / step + 1;
+	return (distance + step - 1) / step;
+}
+`
+
+// arrayPrefix prefixes the C names of the structs arrays are lowered to.
+const arrayPrefix = "__whirl_array_"
+
+// CType is a struct holding a pointer to the elements and their number, so
+// arrays know their length and can be passed around and returned. Every
+// array type used is recorded in the context, to be declared by
+// writeArrays.
+func (a Array) CType(ctx Context) string {
+	name := arrayPrefix + PathToNamespace(strings.TrimPrefix(a.Type.CType(ctx), "struct "))
+
+	if ctx.arrays != nil {
+		ctx.arrays[name] = a.Type
+	}
+
+	return "struct " + name
+}
+
+// CValue copies the elements to the heap, so the array can outlive the
+// procedure that creates it.
+func (a Array) CValue(ctx Context) string {
+	if len(a.Value) == 0 {
+		return fmt.Sprintf("(%s) { NULL, 0 }", a.CType(ctx))
+	}
+
+	var buffer bytes.Buffer
+
+	for i, value := range a.Value {
+		buffer.WriteString(value.CValue(ctx))
+
+		if i != len(a.Value)-1 {
+			buffer.WriteString(", ")
+		}
+	}
+
+	element := a.Type.CType(ctx)
+
+	return fmt.Sprintf("(%s) { __whirl_copy((%s[]) { %s }, sizeof(%s) * %d, %s), %d }",
+		a.CType(ctx), element, buffer.String(), element, len(a.Value), position(a.Span), len(a.Value))
+}
+
+// CValue of an index into an array goes through the accessor of the array
+// type, which panics if the index is out of bounds. Indexing into strings is
+// lowered to the runtime by the checker.
+func (i Index) CValue(ctx Context) string {
+	if i.Vec != nil {
+		return fmt.Sprintf("(*%s_at(%s, %s, %s))", i.Vec.name(ctx), i.Expr.CValue(ctx), i.Index.CValue(ctx), position(i.Span))
+	}
+
+	if i.Array == nil {
+		return fmt.Sprintf("%s[%s]", i.Expr.CValue(ctx), i.Index.CValue(ctx))
+	}
+
+	return fmt.Sprintf("(*%s_at(%s, %s, %s))",
+		strings.TrimPrefix(i.Array.CType(ctx), "struct "), i.Expr.CValue(ctx), i.Index.CValue(ctx), position(i.Span))
+}
+
+func (r RuntimeCall) CValue(ctx Context) string {
+	if r.Position {
+		return operation(ctx, r.Name, r.Args, r.Span)
+	}
+
+	var buffer bytes.Buffer
+
+	buffer.WriteString(r.Name)
+	buffer.WriteString("(")
+
+	for i, arg := range r.Args {
+		buffer.WriteString(arg.CValue(ctx))
+
+		if i != len(r.Args)-1 {
+			buffer.WriteString(", ")
+		}
+	}
+
+	buffer.WriteString(")")
+
+	return buffer.String()
+}
+
+// position returns the start of a span as a C string, for runtime errors.
+func position(span lexer.Span) string {
+	return strconv.Quote(fmt.Sprintf("%s:%d:%d", filepath.Base(span.File), span.Start.Line, span.Start.Column))
+}
+
+// writeArrays writes the structs of the array types recorded in the context.
+// Their elements are pointers, so the element types only have to be
+// declared.
+func writeArrays(ctx Context, out io.Writer) {
+	for _, name := range arrayNames(ctx) {
+		fmt.Fprintf(out, "struct %s { %s* data; int len; };\n", name, ctx.arrays[name].CType(ctx))
+	}
+}
+
+// writeAccessors writes the bounds checked accessors of the array types
+// recorded in the context, which need the full definitions of the element
+// types.
+func writeAccessors(ctx Context, out io.Writer) {
+	for _, name := range arrayNames(ctx) {
+		fmt.Fprintf(out, "static inline %s* %s_at(struct %s a, int i, const char* pos) { ", ctx.arrays[name].CType(ctx), name, name)
+		io.WriteString(out, `if (i < 0 || i >= a.len) __whirl_panic(pos, "index %d out of bounds for length %d", i, a.len); `)
+		io.WriteString(out, "return &a.data[i]; }\n")
+	}
+}
+
+func arrayNames(ctx Context) []string {
+	names := make([]string, 0, len(ctx.arrays))
+
+	for name := range ctx.arrays {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
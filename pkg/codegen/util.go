@@ -1,9 +1,12 @@
 package codegen
 
 import (
-	"bytes"
 	"fmt"
+	"reflect"
 	"regexp"
+	"strings"
+
+	"github.com/whirl-lang/whirl/pkg/lexer"
 )
 
 var reserved = map[string]bool{
@@ -11,44 +14,80 @@ var reserved = map[string]bool{
 	"printf": true,
 }
 
-func TransformIdent(ctx Context, ident string) string {
-	if len(ctx.Namespace) == 0 || reserved[ident] {
-		return ident
+// keywords are the names C or the headers of the runtime keep for
+// themselves, which are allowed in Whirl.
+var keywords = map[string]bool{}
+
+func init() {
+	for _, keyword := range strings.Fields(`
+		auto break case char const continue default do double else enum
+		extern float for goto if inline int long register restrict return
+		short signed sizeof static struct switch typedef union unsigned void
+		volatile while bool true false
+		int8_t int16_t int32_t int64_t uint8_t uint16_t uint32_t uint64_t
+		size_t va_list FILE NULL EOF errno stdin stdout stderr`) {
+		keywords[keyword] = true
+	}
+}
+
+// cName returns the C name of a variable, argument or field, which is its
+// Whirl name unless that is kept by C.
+func cName(name string) string {
+	if keywords[name] {
+		return "__whirl_" + name
 	}
 
-	return fmt.Sprintf("__whirl_%s_%s", PathToNamespace(ctx.Path), ident)
+	return name
 }
 
+// mainPrefix prefixes the C names of the symbols of the main module, whose
+// namespace is empty.
+const mainPrefix = "__whirl_main_"
+
+// entryPoint is the C name of a main procedure that takes the command line
+// arguments, which is called by a generated C main.
+const entryPoint = "__whirl_main"
+
+func TransformIdent(ctx Context, ident string) string {
+	return Mangle(ctx.Module.Namespace, ident)
+}
+
+// TransformPath returns the C name of a procedure or struct. All but the last
+// token of the path name the imported module that declares it.
 func TransformPath(ctx Context, path Path) string {
-	var buffer bytes.Buffer
+	module := ctx.Module
 
-	// if we're in the main namespace and there's just one token, use it
-	if len(ctx.Namespace) == 0 && len(path.Tokens) == 1 {
-		return path.Tokens[0].Name
+	for _, token := range path.Tokens[:len(path.Tokens)-1] {
+		module = module.Imports[token.Name]
 	}
 
-	if len(path.Tokens) == 1 && reserved[path.Tokens[0].Name] {
-		return path.Tokens[0].Name
-	}
+	return Mangle(module.Namespace, path.Tokens[len(path.Tokens)-1].Name)
+}
 
-	buffer.WriteString("__whirl_")
-	buffer.WriteString(PathToNamespace(ctx.Path))
-	buffer.WriteString("_")
+// Mangle returns the C name of a symbol declared in the given namespace. The
+// symbols of the main module are prefixed too, as they could otherwise clash
+// with the C library, like a procedure named free.
+func Mangle(namespace string, ident string) string {
+	if reserved[ident] {
+		return ident
+	}
 
-	for i, token := range path.Tokens {
-		buffer.WriteString(token.Name)
+	if len(namespace) == 0 {
+		return mainPrefix + ident
+	}
 
-		if i != len(path.Tokens)-1 {
-			buffer.WriteString("_")
-		}
+	return fmt.Sprintf("__whirl_%s_%s", namespace, ident)
+}
 
-		// on second-last, append whirl_
-		if i == len(path.Tokens)-2 {
-			buffer.WriteString("whirl_")
-		}
+// MangleMethod returns the C name of a method of a struct declared in the
+// given namespace. Methods have their own prefix, so that they can't clash
+// with procedures.
+func MangleMethod(namespace string, receiver string, method string) string {
+	if len(namespace) == 0 {
+		return fmt.Sprintf("__whirl_method_%s__%s", receiver, method)
 	}
 
-	return buffer.String()
+	return fmt.Sprintf("__whirl_method_%s_%s__%s", namespace, receiver, method)
 }
 
 func PathToNamespace(path string) string {
@@ -56,3 +95,22 @@ func PathToNamespace(path string) string {
 		MustCompile("[^a-zA-Z0-9]").
 		ReplaceAllString(path, "_")
 }
+
+// SpanOf returns the span of an AST node, or an empty span if it has none.
+func SpanOf(node interface{}) lexer.Span {
+	value := reflect.ValueOf(node)
+
+	if value.Kind() != reflect.Struct {
+		return lexer.Span{}
+	}
+
+	field := value.FieldByName("Span")
+
+	if !field.IsValid() {
+		return lexer.Span{}
+	}
+
+	span, _ := field.Interface().(lexer.Span)
+
+	return span
+}
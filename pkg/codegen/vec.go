@@ -0,0 +1,126 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/whirl-lang/whirl/pkg/lexer"
+)
+
+// vecPrefix prefixes the C names of the structs vectors are lowered to and
+// of their operations.
+const vecPrefix = "__whirl_vec_"
+
+// name returns the C name of the struct of the vector type, recording it in
+// the context to be declared by writeVecs.
+func (v Vec) name(ctx Context) string {
+	name := vecPrefix + PathToNamespace(strings.TrimPrefix(v.Type.CType(ctx), "struct "))
+
+	if ctx.vecs != nil {
+		ctx.vecs[name] = v.Type
+	}
+
+	return name
+}
+
+// CType is a pointer to a struct holding the elements, their number and the
+// capacity, so that pushing through one copy of a vector is seen by all.
+func (v Vec) CType(ctx Context) string {
+	return "struct " + v.name(ctx) + "*"
+}
+
+// CValue creates a vector with the elements of the literal.
+func (v Vec) CValue(ctx Context) string {
+	name := v.name(ctx)
+
+	if len(v.Value) == 0 {
+		return fmt.Sprintf("%s_new(NULL, 0, %s)", name, position(v.Span))
+	}
+
+	var buffer bytes.Buffer
+
+	for i, value := range v.Value {
+		buffer.WriteString(value.CValue(ctx))
+
+		if i != len(v.Value)-1 {
+			buffer.WriteString(", ")
+		}
+	}
+
+	return fmt.Sprintf("%s_new((%s[]) { %s }, %d, %s)", name, v.Type.CType(ctx), buffer.String(), len(v.Value), position(v.Span))
+}
+
+// CValue calls the operation with the position of the call, for the errors
+// of the runtime.
+func (v VecCall) CValue(ctx Context) string {
+	return operation(ctx, v.Vec.name(ctx)+"_"+v.Name, v.Args, v.Span)
+}
+
+// operation calls an operation of the runtime of a vector or map type,
+// passing the position of the call last.
+func operation(ctx Context, name string, args []Expr, span lexer.Span) string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString(name)
+	buffer.WriteString("(")
+
+	for _, arg := range args {
+		buffer.WriteString(arg.CValue(ctx))
+		buffer.WriteString(", ")
+	}
+
+	buffer.WriteString(position(span))
+	buffer.WriteString(")")
+
+	return buffer.String()
+}
+
+// writeVecs writes the structs of the vector types recorded in the context,
+// which like arrays only point to their elements.
+func writeVecs(ctx Context, out io.Writer) {
+	for _, name := range vecNames(ctx) {
+		fmt.Fprintf(out, "struct %s { %s* data; int len; int cap; };\n", name, ctx.vecs[name].CType(ctx))
+	}
+}
+
+// writeVecOperations writes the operations of the vector types recorded in
+// the context, which need the full definitions of the element types.
+func writeVecOperations(ctx Context, out io.Writer) {
+	for _, name := range vecNames(ctx) {
+		element := ctx.vecs[name].CType(ctx)
+
+		fmt.Fprintf(out, "static inline void %s_push(struct %s* v, %s value, const char* pos) { ", name, name, element)
+		io.WriteString(out, "if (v->len == v->cap) { v->cap = v->cap ? v->cap * 2 : 4; v->data = __whirl_alloc(v->data, sizeof(*v->data) * v->cap, pos); } ")
+		io.WriteString(out, "v->data[v->len++] = value; }\n")
+
+		fmt.Fprintf(out, "static inline %s %s_pop(struct %s* v, const char* pos) { ", element, name, name)
+		io.WriteString(out, `if (v->len == 0) __whirl_panic(pos, "cannot pop from an empty Vec"); `)
+		io.WriteString(out, "return v->data[--v->len]; }\n")
+
+		fmt.Fprintf(out, "static inline %s* %s_at(struct %s* v, int i, const char* pos) { ", element, name, name)
+		io.WriteString(out, `if (i < 0 || i >= v->len) __whirl_panic(pos, "index %d out of bounds for length %d", i, v->len); `)
+		io.WriteString(out, "return &v->data[i]; }\n")
+
+		fmt.Fprintf(out, "static inline struct %s* %s_new(%s* items, int len, const char* pos) { ", name, name, element)
+		fmt.Fprintf(out, "struct %s* v = __whirl_alloc(NULL, sizeof(struct %s), pos); ", name, name)
+		io.WriteString(out, "v->data = NULL; v->len = 0; v->cap = 0; ")
+		io.WriteString(out, "for (int i = 0; i < len; i++) ")
+		fmt.Fprintf(out, "%s_push(v, items[i], pos); ", name)
+		io.WriteString(out, "return v; }\n")
+	}
+}
+
+func vecNames(ctx Context) []string {
+	names := make([]string, 0, len(ctx.vecs))
+
+	for name := range ctx.vecs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
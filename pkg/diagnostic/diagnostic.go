@@ -0,0 +1,164 @@
+package diagnostic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/whirl-lang/whirl/pkg/lexer"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	}
+
+	return "error"
+}
+
+// Fix is a suggested edit that replaces the source covered by Span.
+type Fix struct {
+	Span        lexer.Span
+	Replacement string
+	Message     string
+}
+
+// Diagnostic is a message about a location in the source. It implements
+// error so that it can be returned from the lexer, parser and later passes.
+type Diagnostic struct {
+	Severity Severity
+	Span     lexer.Span
+	Message  string
+	Notes    []string
+	Fixes    []Fix
+}
+
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s: %s", d.Span, d.Severity, d.Message)
+}
+
+// WithNote returns a copy of the diagnostic with an extra note attached.
+func (d Diagnostic) WithNote(format string, args ...interface{}) Diagnostic {
+	d.Notes = append(d.Notes[:len(d.Notes):len(d.Notes)], fmt.Sprintf(format, args...))
+
+	return d
+}
+
+// WithFix returns a copy of the diagnostic with a suggested fix attached.
+func (d Diagnostic) WithFix(span lexer.Span, replacement string, message string) Diagnostic {
+	d.Fixes = append(d.Fixes[:len(d.Fixes):len(d.Fixes)], Fix{Span: span, Replacement: replacement, Message: message})
+
+	return d
+}
+
+// List is a list of diagnostics that can be returned as a single error.
+type List []Diagnostic
+
+func (l List) Error() string {
+	messages := make([]string, len(l))
+
+	for i, diagnostic := range l {
+		messages[i] = diagnostic.Error()
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// Err returns the list as an error, or nil if it is empty.
+func (l List) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+
+	return l
+}
+
+func Errorf(span lexer.Span, format string, args ...interface{}) Diagnostic {
+	return Diagnostic{Severity: Error, Span: span, Message: fmt.Sprintf(format, args...)}
+}
+
+func Warningf(span lexer.Span, format string, args ...interface{}) Diagnostic {
+	return Diagnostic{Severity: Warning, Span: span, Message: fmt.Sprintf(format, args...)}
+}
+
+// FromError turns any error into a diagnostic, keeping the location of
+// diagnostics and lexer errors. A list is turned into its first diagnostic.
+func FromError(err error) Diagnostic {
+	var diagnostic Diagnostic
+
+	if errors.As(err, &diagnostic) {
+		return diagnostic
+	}
+
+	var list List
+
+	if errors.As(err, &list) && len(list) > 0 {
+		return list[0]
+	}
+
+	var lexerError lexer.Error
+
+	if errors.As(err, &lexerError) {
+		return Errorf(lexerError.Span, "%s", lexerError.Message)
+	}
+
+	return Diagnostic{Severity: Error, Message: err.Error()}
+}
+
+// Collector gathers the diagnostics of a compilation along with the sources
+// they point into.
+type Collector struct {
+	Diagnostics []Diagnostic
+	Sources     map[string][]byte
+}
+
+func NewCollector() *Collector {
+	return &Collector{Sources: map[string][]byte{}}
+}
+
+// AddSource records the content of a file so diagnostics in it can be rendered.
+func (c *Collector) AddSource(file string, content []byte) {
+	c.Sources[file] = content
+}
+
+func (c *Collector) Report(diagnostic Diagnostic) {
+	c.Diagnostics = append(c.Diagnostics, diagnostic)
+}
+
+// ReportError reports an error returned by one of the compiler stages.
+func (c *Collector) ReportError(err error) {
+	var list List
+
+	if errors.As(err, &list) {
+		c.Diagnostics = append(c.Diagnostics, list...)
+
+		return
+	}
+
+	c.Report(FromError(err))
+}
+
+// Errors returns the number of error diagnostics reported so far.
+func (c *Collector) Errors() int {
+	count := 0
+
+	for _, diagnostic := range c.Diagnostics {
+		if diagnostic.Severity == Error {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (c *Collector) HasErrors() bool {
+	return c.Errors() > 0
+}
@@ -2,17 +2,25 @@ package lexer
 
 import (
 	"bytes"
-	"errors"
+	"fmt"
+	"unicode/utf8"
 )
 
 type TokenIterator struct {
 	Bytes     []byte
 	NextToken *Token
+
+	// File is the path recorded in the span of every token.
+	File string
+	// Position is the location of the first byte in Bytes.
+	Position Position
+	// Previous is the last token returned by Next.
+	Previous Token
 }
 
 func (iter *TokenIterator) Peek() (Token, error) {
 	if iter.NextToken == nil {
-		token, err := iter.Next()
+		token, err := iter.scan()
 
 		if err != nil {
 			return Token{}, err
@@ -23,61 +31,90 @@ func (iter *TokenIterator) Peek() (Token, error) {
 
 	return *iter.NextToken, nil
 }
+
+// Advance consumes n bytes, keeping track of the line and column.
+func (iter *TokenIterator) Advance(n int) {
+	for _, b := range iter.Bytes[:n] {
+		if b == '\n' {
+			iter.Position.Line++
+			iter.Position.Column = 1
+		} else {
+			iter.Position.Column++
+		}
+	}
+
+	iter.Position.Offset += n
+	iter.Bytes = iter.Bytes[n:]
+}
+
 func SkipWhitespace(iter *TokenIterator) {
 	if len(iter.Bytes) == 0 {
 		return
 	}
 
 	for iter.Bytes[0] == ' ' || iter.Bytes[0] == '\n' || iter.Bytes[0] == '\t' || iter.Bytes[0] == '\r' {
-		iter.Bytes = iter.Bytes[1:]
+		iter.Advance(1)
 
 		if len(iter.Bytes) == 0 {
 			return
 		}
 	}
 }
+
 func (iter *TokenIterator) Next() (Token, error) {
 
 	if iter.NextToken != nil {
 		token := *iter.NextToken
 		iter.NextToken = nil
+		iter.Previous = token
 
 		return token, nil
 	}
 
-	if len(iter.Bytes) == 0 {
-		return Token{EOF, ""}, nil
+	token, err := iter.scan()
+
+	if err != nil {
+		return token, err
 	}
 
-	SkipWhitespace(iter)
+	iter.Previous = token
 
-	if len(iter.Bytes) == 0 {
-		return Token{EOF, ""}, nil
+	return token, nil
+}
+
+// token builds a token spanning from start to the current position.
+func (iter *TokenIterator) token(kind int, value string, start Position) Token {
+	return Token{
+		Kind:  kind,
+		Value: value,
+		Span:  Span{File: iter.File, Start: start, End: iter.Position},
 	}
+}
 
-	if iter.Bytes[0] == '$' {
-		for iter.Bytes[0] != '\n' {
-			iter.Bytes = iter.Bytes[1:]
+func (iter *TokenIterator) scan() (Token, error) {
+	SkipWhitespace(iter)
 
-			if len(iter.Bytes) == 0 {
-				return Token{EOF, ""}, nil
-			}
+	for len(iter.Bytes) > 0 && iter.Bytes[0] == '$' {
+		for len(iter.Bytes) > 0 && iter.Bytes[0] != '\n' {
+			iter.Advance(1)
 		}
+
+		SkipWhitespace(iter)
 	}
 
-	SkipWhitespace(iter)
+	start := iter.Position
 
 	if len(iter.Bytes) == 0 {
-		return Token{EOF, ""}, nil
+		return iter.token(EOF, "", start), nil
 	}
 
 	// check for keywords
 	//keywords must have a space, tab or newline after them
-	for i := IF; i <= AS; i++ {
+	for i := IF; i <= MUT; i++ {
 		word := TokensWithSpace[i]
 
 		if iter.FoundToken(word, true) {
-			return Token{i, string(word)}, nil
+			return iter.token(i, string(word), start), nil
 		}
 	}
 
@@ -86,72 +123,59 @@ func (iter *TokenIterator) Next() (Token, error) {
 		word := TokensWithoutSpace[i]
 
 		if iter.FoundToken(word, false) {
-			return Token{i, string(word)}, nil
+			return iter.token(i, string(word), start), nil
 		}
 	}
 
 	//Check for booleans
 	if iter.FoundToken([]byte("false"), true) {
-		return Token{BOOLEAN_LIT, "0"}, nil
+		return iter.token(BOOLEAN_LIT, "0", start), nil
 	}
 
 	if iter.FoundToken([]byte("true"), true) {
-		return Token{BOOLEAN_LIT, "1"}, nil
+		return iter.token(BOOLEAN_LIT, "1", start), nil
 	}
 
 	//Check for strings
 	if iter.Bytes[0] == '"' {
-		iter.Bytes = iter.Bytes[1:]
-		var str []byte
-
-		for iter.Bytes[0] != '"' {
-			str = append(str, iter.Bytes[0])
-			iter.Bytes = iter.Bytes[1:]
-		}
-
-		iter.Bytes = iter.Bytes[1:]
+		return iter.scanString(start)
+	}
 
-		return Token{STRING_LIT, "\"" + string(str) + "\""}, nil
+	if hashes, ok := iter.rawString(); ok {
+		return iter.scanRawString(start, hashes)
 	}
 
 	//check for char
 	if iter.Bytes[0] == '\'' {
-		if len(iter.Bytes) >= 3 && iter.Bytes[2] == '\'' {
-			char := iter.Bytes[1]
-			iter.Bytes = iter.Bytes[3:]
-
-			return Token{CHAR_LIT, string(char)}, nil
-		}
+		return iter.scanChar(start)
 	}
 
-	//check for int
-	if iter.Bytes[0] >= '0' && iter.Bytes[0] <= '9' {
-		length := 0
-
-		for iter.Bytes[length] >= '0' && iter.Bytes[length] <= '9' {
-			length++
-		}
-
-		num := iter.Bytes[:length]
-		iter.Bytes = iter.Bytes[length:]
-		return Token{INT_LIT, string(num)}, nil
+	//check for numbers
+	if isDigit(iter.Bytes[0]) {
+		return iter.scanNumber(start)
 	}
 
-	//check for identifier
+	//check for identifier, which can have digits after the first letter
 	index := 0
 
-	for (iter.Bytes[index] >= 'a' && iter.Bytes[index] <= 'z') || (iter.Bytes[index] >= 'A' && iter.Bytes[index] <= 'Z') || iter.Bytes[index] == '_' {
+	for index < len(iter.Bytes) && (isLetter(iter.Bytes[index]) || iter.Bytes[index] == '_' || (index > 0 && isDigit(iter.Bytes[index]))) {
 		index++
 	}
 
 	if index == 0 {
-		return Token{}, errors.New("unknown symbol found")
+		symbol, size := utf8.DecodeRune(iter.Bytes)
+		iter.Advance(size)
+
+		return Token{}, Error{
+			Span:    iter.token(EOF, "", start).Span,
+			Message: fmt.Sprintf("unknown symbol %q", symbol),
+		}
 	}
 
-	str := iter.Bytes[:index]
-	iter.Bytes = iter.Bytes[index:]
+	str := string(iter.Bytes[:index])
+	iter.Advance(index)
 
-	return Token{IDENT, string(str)}, nil
+	return iter.token(IDENT, str, start), nil
 }
 
 func (iter *TokenIterator) FoundToken(token []byte, seperation bool) bool {
@@ -163,7 +187,7 @@ func (iter *TokenIterator) FoundToken(token []byte, seperation bool) bool {
 	}
 
 	if hasPrefix && len(iter.Bytes) >= length {
-		iter.Bytes = iter.Bytes[length:]
+		iter.Advance(length)
 	}
 
 	return hasPrefix
@@ -188,6 +212,9 @@ var TokensWithSpace = [][]byte{
 	IN:       []byte("in"),
 	IMPORT:   []byte("import"),
 	AS:       []byte("as"),
+	ENUM:     []byte("enum"),
+	MATCH:    []byte("match"),
+	MUT:      []byte("mut"),
 }
 
 var TokensWithoutSpace = [][]byte{
@@ -200,12 +227,15 @@ var TokensWithoutSpace = [][]byte{
 	AND: []byte("&&"),
 	OR:  []byte("||"),
 	NOT: []byte("!"),
+	REF: []byte("&"),
 
 	COLONCOLON: []byte("::"),
 	COLON:      []byte(":"),
 	COMMA:      []byte(","),
 	SEMICOLON:  []byte(";"),
 	ASSIGN:     []byte("="),
+	FATARROW:   []byte("=>"),
+	DOTDOTEQ:   []byte("..="),
 	PERIOD:     []byte("."),
 
 	PARENOPEN:    []byte("("),
@@ -228,9 +258,44 @@ var TokensWithoutSpace = [][]byte{
 	STRING:  []byte("string"),
 }
 
+// Position is a location in a source file. Offset is a byte offset, Line and
+// Column are 1-based.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Span covers the bytes from Start up to (but not including) End.
+type Span struct {
+	File  string
+	Start Position
+	End   Position
+}
+
+// To returns a span from the start of s to the end of other.
+func (s Span) To(other Span) Span {
+	return Span{File: s.File, Start: s.Start, End: other.End}
+}
+
+func (s Span) String() string {
+	return fmt.Sprintf("%s:%d:%d", s.File, s.Start.Line, s.Start.Column)
+}
+
+// Error is an error found while scanning the source.
+type Error struct {
+	Span    Span
+	Message string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Span, e.Message)
+}
+
 type Token struct {
 	Kind  int
 	Value string
+	Span  Span
 }
 
 func (t Token) IsSeparator() bool {
@@ -251,6 +316,9 @@ var TokensPretty = []string{
 	IN:       "in",
 	IMPORT:   "import",
 	AS:       "as",
+	ENUM:     "enum",
+	MATCH:    "match",
+	MUT:      "mut",
 
 	LE:  "<=",
 	GE:  ">=",
@@ -261,7 +329,10 @@ var TokensPretty = []string{
 	AND: "&&",
 	OR:  "||",
 	NOT: "!",
+	REF: "&",
 
+	FATARROW:   "=>",
+	DOTDOTEQ:   "..=",
 	PERIOD:     ".",
 	COLONCOLON: "::",
 	COLON:      ":",
@@ -290,6 +361,7 @@ var TokensPretty = []string{
 
 	IDENT:       "<identifier>",
 	INT_LIT:     "<integer>",
+	FLOAT_LIT:   "<float>",
 	STRING_LIT:  "<string>",
 	BOOLEAN_LIT: "<boolean>",
 	CHAR_LIT:    "<character>",
@@ -314,6 +386,9 @@ const (
 	IN
 	IMPORT
 	AS
+	ENUM
+	MATCH
+	MUT
 
 	//Operators
 	LE
@@ -325,7 +400,10 @@ const (
 	AND
 	OR
 	NOT
+	REF // this is & while AND is &&
 
+	FATARROW
+	DOTDOTEQ
 	PERIOD
 	COLONCOLON
 	COLON
@@ -360,6 +438,7 @@ const (
 	//Literals
 	IDENT
 	INT_LIT
+	FLOAT_LIT
 	STRING_LIT
 	BOOLEAN_LIT
 	CHAR_LIT
@@ -368,5 +447,8 @@ const (
 )
 
 func Iterator(input []byte) TokenIterator {
-	return TokenIterator{input, nil}
+	return TokenIterator{
+		Bytes:    input,
+		Position: Position{Line: 1, Column: 1},
+	}
 }
@@ -36,6 +36,143 @@ func TestLexerIf(t *testing.T) {
 	}
 }
 
+func TestLexerPositions(t *testing.T) {
+	i := Iterator([]byte("proc main() :: int {\n\t$ comment\n\tescape 0;\n}"))
+	i.File = "main.whirl"
+
+	expected := map[int]Position{
+		PROC:       {Offset: 0, Line: 1, Column: 1},
+		COLONCOLON: {Offset: 12, Line: 1, Column: 13},
+		ESCAPE:     {Offset: 33, Line: 3, Column: 2},
+		INT_LIT:    {Offset: 40, Line: 3, Column: 9},
+		CURLYCLOSE: {Offset: 43, Line: 4, Column: 1},
+	}
+
+	for {
+		token, err := i.Next()
+
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		if token.Kind == EOF {
+			break
+		}
+
+		if token.Span.File != "main.whirl" {
+			t.Fatalf("expected file main.whirl, got %s", token.Span.File)
+		}
+
+		if position, ok := expected[token.Kind]; ok && token.Span.Start != position {
+			t.Fatalf("expected %s at %v, got %v", TokensPretty[token.Kind], position, token.Span.Start)
+		}
+	}
+}
+
+func TestLexerStrings(t *testing.T) {
+	literals := map[string]string{
+		`"say \"hi\"\n"`:          "say \"hi\"\n",
+		`"tab\there \\ \u{e9}"`:   "tab\there \\ \u00e9",
+		"\"two\nlines\"":          "two\nlines",
+		"\"joined \\\n    here\"": "joined here",
+		`r"C:\path\n"`:            `C:\path\n`,
+		`r#"a "quoted" word"#`:    `a "quoted" word`,
+	}
+
+	for input, expected := range literals {
+		i := Iterator([]byte(input))
+		token, err := i.Next()
+
+		if err != nil {
+			t.Fatalf("%s: %s", input, err)
+		}
+
+		if token.Kind != STRING_LIT || token.Value != "\""+expected+"\"" {
+			t.Fatalf("%s: expected %q, got %s %q", input, expected, TokensPretty[token.Kind], token.Value)
+		}
+	}
+
+	errors := map[string]string{
+		`"unterminated`:    "unterminated string",
+		`r#"unterminated"`: "unterminated raw string",
+		`"\q"`:             "unknown escape sequence \\q",
+		`"\u{d800}"`:       "\\u{d800} is not a unicode character",
+		`"\u{1234567}"`:    "a unicode escape must have 1 to 6 hex digits",
+		`'ab'`:             "a character literal must hold a single ASCII character",
+	}
+
+	for input, expected := range errors {
+		i := Iterator([]byte(input))
+		_, err := i.Next()
+
+		if err == nil || err.(Error).Message != expected {
+			t.Fatalf("%s: expected %q, got %v", input, expected, err)
+		}
+
+		// the rest of the input is still scanned
+		if token, err := i.Next(); err != nil || token.Kind != EOF {
+			t.Fatalf("%s: expected EOF, got %v %v", input, token, err)
+		}
+	}
+}
+
+func TestLexerNumbers(t *testing.T) {
+	numbers := map[string]Token{
+		"1_000_000": {Kind: INT_LIT, Value: "1000000"},
+		"0xFF_ff":   {Kind: INT_LIT, Value: "0xFFff"},
+		"0o17":      {Kind: INT_LIT, Value: "0o17"},
+		"0b1010":    {Kind: INT_LIT, Value: "0b1010"},
+		"3.25":      {Kind: FLOAT_LIT, Value: "3.25"},
+		"1e-3":      {Kind: FLOAT_LIT, Value: "1e-3"},
+		"6.02E+23":  {Kind: FLOAT_LIT, Value: "6.02e+23"},
+	}
+
+	for input, expected := range numbers {
+		i := Iterator([]byte(input))
+		token, err := i.Next()
+
+		if err != nil {
+			t.Fatalf("%s: %s", input, err)
+		}
+
+		if token.Kind != expected.Kind || token.Value != expected.Value {
+			t.Fatalf("%s: expected %s %q, got %s %q", input, TokensPretty[expected.Kind], expected.Value, TokensPretty[token.Kind], token.Value)
+		}
+	}
+
+	// a period not followed by a digit isn't part of the number
+	kinds := []int{INT_LIT, DOTDOTEQ, INT_LIT, INT_LIT, PERIOD, IDENT}
+	i := Iterator([]byte("0..=9 1.x"))
+
+	for _, kind := range kinds {
+		if token, err := i.Next(); err != nil || token.Kind != kind {
+			t.Fatalf("expected %s, got %v %v", TokensPretty[kind], token, err)
+		}
+	}
+
+	errors := map[string]string{
+		"0x":    "expected hex digits after 0x",
+		"0b102": "invalid digit '2' in binary literal",
+		"1__0":  "_ can only separate digits",
+		"10_":   "_ can only separate digits",
+		"1e+":   "expected digits in the exponent",
+		"12abc": "unexpected \"abc\" after a number",
+	}
+
+	for input, expected := range errors {
+		i := Iterator([]byte(input))
+		_, err := i.Next()
+
+		if err == nil || err.(Error).Message != expected {
+			t.Fatalf("%s: expected %q, got %v", input, expected, err)
+		}
+
+		if token, err := i.Next(); err != nil || token.Kind != EOF {
+			t.Fatalf("%s: expected EOF, got %v %v", input, token, err)
+		}
+	}
+}
+
 func CheckForErrorsInIterator(input []byte) error {
 	i := Iterator([]byte(input))
 
@@ -0,0 +1,130 @@
+package lexer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// bases are the prefixes of int literals that aren't decimal.
+var bases = map[byte]struct {
+	name  string
+	digit func(b byte) bool
+}{
+	'x': {"hex", isHex},
+	'o': {"octal", func(b byte) bool { return b >= '0' && b <= '7' }},
+	'b': {"binary", func(b byte) bool { return b == '0' || b == '1' }},
+}
+
+// scanNumber scans an int literal, which is decimal unless it starts with
+// 0x, 0o or 0b, or a float literal, which has a fraction, an exponent or
+// both. Digits can be separated by _, which is left out of the value of the
+// token.
+func (iter *TokenIterator) scanNumber(start Position) (Token, error) {
+	if len(iter.Bytes) > 1 && iter.Bytes[0] == '0' {
+		if base, ok := bases[iter.Bytes[1]]; ok {
+			prefix := string(iter.Bytes[:2])
+			iter.Advance(2)
+
+			digits := iter.word()
+
+			if digits == "" {
+				return Token{}, iter.numberError(start, "expected %s digits after %s", base.name, prefix)
+			}
+
+			for i := 0; i < len(digits); i++ {
+				if digits[i] != '_' && !base.digit(digits[i]) {
+					return Token{}, iter.numberError(start, "invalid digit %q in %s literal", digits[i], base.name)
+				}
+			}
+
+			return iter.number(INT_LIT, prefix+digits, start)
+		}
+	}
+
+	kind := INT_LIT
+	value := iter.digits()
+
+	// a period followed by a digit starts a fraction, otherwise it is a
+	// field access or a range like 0..=9
+	if len(iter.Bytes) > 1 && iter.Bytes[0] == '.' && isDigit(iter.Bytes[1]) {
+		iter.Advance(1)
+		kind = FLOAT_LIT
+		value += "." + iter.digits()
+	}
+
+	if len(iter.Bytes) > 0 && (iter.Bytes[0] == 'e' || iter.Bytes[0] == 'E') {
+		iter.Advance(1)
+		kind = FLOAT_LIT
+		value += "e"
+
+		if len(iter.Bytes) > 0 && (iter.Bytes[0] == '+' || iter.Bytes[0] == '-') {
+			value += string(iter.Bytes[0])
+			iter.Advance(1)
+		}
+
+		if len(iter.Bytes) == 0 || !isDigit(iter.Bytes[0]) {
+			return Token{}, iter.numberError(start, "expected digits in the exponent")
+		}
+
+		value += iter.digits()
+	}
+
+	if suffix := iter.word(); suffix != "" {
+		return Token{}, iter.numberError(start, "unexpected %q after a number", suffix)
+	}
+
+	return iter.number(kind, value, start)
+}
+
+// number returns the token of a number literal, checking its separators.
+func (iter *TokenIterator) number(kind int, value string, start Position) (Token, error) {
+	if strings.HasSuffix(value, "_") || strings.Contains(value, "__") || strings.Contains(value, "_.") || strings.Contains(value, "_e") {
+		return Token{}, iter.numberError(start, "_ can only separate digits")
+	}
+
+	return iter.token(kind, strings.ReplaceAll(value, "_", ""), start), nil
+}
+
+// digits scans decimal digits and separators.
+func (iter *TokenIterator) digits() string {
+	length := 0
+
+	for length < len(iter.Bytes) && (isDigit(iter.Bytes[length]) || iter.Bytes[length] == '_') {
+		length++
+	}
+
+	digits := string(iter.Bytes[:length])
+	iter.Advance(length)
+
+	return digits
+}
+
+// word scans letters, digits and separators, which can't follow a number
+// literal.
+func (iter *TokenIterator) word() string {
+	length := 0
+
+	for length < len(iter.Bytes) && (isDigit(iter.Bytes[length]) || isLetter(iter.Bytes[length]) || iter.Bytes[length] == '_') {
+		length++
+	}
+
+	word := string(iter.Bytes[:length])
+	iter.Advance(length)
+
+	return word
+}
+
+func (iter *TokenIterator) numberError(start Position, format string, args ...interface{}) error {
+	// the rest of the literal is part of the error
+	iter.word()
+
+	return Error{Span: iter.token(EOF, "", start).Span, Message: fmt.Sprintf(format, args...)}
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func isLetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
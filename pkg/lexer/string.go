@@ -0,0 +1,224 @@
+package lexer
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// scanString scans a string literal, replacing its escape sequences with the
+// characters they stand for. A string can span lines, and a backslash at the
+// end of a line skips the line break and the indentation of the next line.
+// An invalid escape sequence is reported once the whole string is scanned,
+// so that scanning can go on after it.
+func (iter *TokenIterator) scanString(start Position) (Token, error) {
+	iter.Advance(1)
+	opened := iter.Position
+
+	var str []byte
+	var invalid error
+
+	for {
+		if len(iter.Bytes) == 0 {
+			return Token{}, Error{Span: Span{File: iter.File, Start: start, End: opened}, Message: "unterminated string"}
+		}
+
+		switch iter.Bytes[0] {
+		case '"':
+			iter.Advance(1)
+
+			if invalid != nil {
+				return Token{}, invalid
+			}
+
+			return iter.token(STRING_LIT, "\""+string(str)+"\"", start), nil
+		case '\\':
+			escaped, err := iter.escape()
+
+			if err != nil && invalid == nil {
+				invalid = err
+			}
+
+			str = append(str, escaped...)
+		default:
+			str = append(str, iter.Bytes[0])
+			iter.Advance(1)
+		}
+	}
+}
+
+// rawString reports whether a raw string starts at the current position,
+// which is an r followed by any number of # and a quote, and returns the
+// number of #.
+func (iter *TokenIterator) rawString() (int, bool) {
+	if len(iter.Bytes) == 0 || iter.Bytes[0] != 'r' {
+		return 0, false
+	}
+
+	hashes := 0
+
+	for 1+hashes < len(iter.Bytes) && iter.Bytes[1+hashes] == '#' {
+		hashes++
+	}
+
+	return hashes, 1+hashes < len(iter.Bytes) && iter.Bytes[1+hashes] == '"'
+}
+
+// scanRawString scans a raw string, whose characters are taken as they are
+// up to a quote followed by as many # as the string started with.
+func (iter *TokenIterator) scanRawString(start Position, hashes int) (Token, error) {
+	iter.Advance(2 + hashes)
+	opened := iter.Position
+
+	end := append([]byte{'"'}, bytes.Repeat([]byte{'#'}, hashes)...)
+	length := bytes.Index(iter.Bytes, end)
+
+	if length == -1 {
+		iter.Advance(len(iter.Bytes))
+
+		return Token{}, Error{Span: Span{File: iter.File, Start: start, End: opened}, Message: "unterminated raw string"}
+	}
+
+	str := string(iter.Bytes[:length])
+	iter.Advance(length + len(end))
+
+	return iter.token(STRING_LIT, "\""+str+"\"", start), nil
+}
+
+// scanChar scans a character literal, which holds a single ASCII character
+// or an escape sequence standing for one.
+func (iter *TokenIterator) scanChar(start Position) (Token, error) {
+	iter.Advance(1)
+
+	var char []byte
+	var err error
+
+	switch {
+	case len(iter.Bytes) > 0 && iter.Bytes[0] == '\\':
+		char, err = iter.escape()
+
+		if err != nil {
+			return Token{}, err
+		}
+	case len(iter.Bytes) > 0 && iter.Bytes[0] != '\'' && iter.Bytes[0] != '\n':
+		_, size := utf8.DecodeRune(iter.Bytes)
+		char = iter.Bytes[:size]
+		iter.Advance(size)
+	}
+
+	// anything else up to the end of the line is part of the literal
+	rest := 0
+
+	for rest < len(iter.Bytes) && iter.Bytes[rest] != '\'' && iter.Bytes[rest] != '\n' {
+		rest++
+	}
+
+	iter.Advance(rest)
+
+	if len(iter.Bytes) == 0 || iter.Bytes[0] != '\'' {
+		return Token{}, Error{Span: iter.token(EOF, "", start).Span, Message: "unterminated character literal"}
+	}
+
+	iter.Advance(1)
+
+	if rest > 0 || len(char) != 1 || char[0] >= utf8.RuneSelf {
+		return Token{}, Error{Span: iter.token(EOF, "", start).Span, Message: "a character literal must hold a single ASCII character"}
+	}
+
+	return iter.token(CHAR_LIT, string(char), start), nil
+}
+
+// escape scans the escape sequence at the current position and returns the
+// bytes it stands for.
+func (iter *TokenIterator) escape() ([]byte, error) {
+	start := iter.Position
+
+	// the string or character literal is unterminated
+	if len(iter.Bytes) < 2 {
+		iter.Advance(len(iter.Bytes))
+
+		return nil, nil
+	}
+
+	switch iter.Bytes[1] {
+	case 'n':
+		iter.Advance(2)
+		return []byte{'\n'}, nil
+	case 't':
+		iter.Advance(2)
+		return []byte{'\t'}, nil
+	case 'r':
+		iter.Advance(2)
+		return []byte{'\r'}, nil
+	case '0':
+		iter.Advance(2)
+		return []byte{0}, nil
+	case '\\', '"', '\'':
+		escaped := iter.Bytes[1]
+		iter.Advance(2)
+
+		return []byte{escaped}, nil
+	case '\n', '\r':
+		iter.Advance(1)
+		SkipWhitespace(iter)
+
+		return nil, nil
+	case 'u':
+		return iter.unicode(start)
+	}
+
+	r, size := utf8.DecodeRune(iter.Bytes[1:])
+	iter.Advance(1 + size)
+
+	return nil, Error{
+		Span:    Span{File: iter.File, Start: start, End: iter.Position},
+		Message: fmt.Sprintf("unknown escape sequence \\%c", r),
+	}
+}
+
+// unicode scans a \u{...} escape sequence, the hex code of a unicode
+// character, and returns the character encoded as UTF-8.
+func (iter *TokenIterator) unicode(start Position) ([]byte, error) {
+	iter.Advance(2)
+
+	invalid := func(message string) ([]byte, error) {
+		return nil, Error{Span: Span{File: iter.File, Start: start, End: iter.Position}, Message: message}
+	}
+
+	if len(iter.Bytes) == 0 || iter.Bytes[0] != '{' {
+		return invalid("expected { after \\u")
+	}
+
+	iter.Advance(1)
+	length := 0
+
+	for length < len(iter.Bytes) && isHex(iter.Bytes[length]) {
+		length++
+	}
+
+	digits := string(iter.Bytes[:length])
+	iter.Advance(length)
+
+	if len(iter.Bytes) == 0 || iter.Bytes[0] != '}' {
+		return invalid("expected } to end the unicode escape")
+	}
+
+	iter.Advance(1)
+
+	if length == 0 || length > 6 {
+		return invalid("a unicode escape must have 1 to 6 hex digits")
+	}
+
+	code, _ := strconv.ParseUint(digits, 16, 32)
+
+	if !utf8.ValidRune(rune(code)) {
+		return invalid(fmt.Sprintf("\\u{%s} is not a unicode character", digits))
+	}
+
+	return utf8.AppendRune(nil, rune(code)), nil
+}
+
+func isHex(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
@@ -2,12 +2,13 @@ package parser
 
 import (
 	"github.com/whirl-lang/whirl/pkg/codegen"
+	"github.com/whirl-lang/whirl/pkg/diagnostic"
 	"github.com/whirl-lang/whirl/pkg/lexer"
 )
 
 func ParseAssignment(tokens *lexer.TokenIterator) (codegen.Assignment, error) {
 	// get "let"
-	_, err := ExpectToken(tokens, lexer.LET)
+	start, err := ExpectToken(tokens, lexer.LET)
 
 	if err != nil {
 		return codegen.Assignment{}, err
@@ -20,18 +21,22 @@ func ParseAssignment(tokens *lexer.TokenIterator) (codegen.Assignment, error) {
 		return codegen.Assignment{}, err
 	}
 
-	// parse colon
-	_, err = ExpectToken(tokens, lexer.COLON)
+	// the type is optional and inferred from the value if left out
+	var typ codegen.Type
+	next, err := tokens.Peek()
 
 	if err != nil {
 		return codegen.Assignment{}, err
 	}
 
-	// parse type
-	typ, err := ParseType(tokens)
+	if next.Kind == lexer.COLON {
+		tokens.Next()
 
-	if err != nil {
-		return codegen.Assignment{}, err
+		typ, err = ParseType(tokens)
+
+		if err != nil {
+			return codegen.Assignment{}, err
+		}
 	}
 
 	// get equals
@@ -41,8 +46,8 @@ func ParseAssignment(tokens *lexer.TokenIterator) (codegen.Assignment, error) {
 		return codegen.Assignment{}, err
 	}
 
-	switch typ.(type) {
-	case codegen.Ident:
+	// empty struct initializers are only allowed here, see ParsePrimary
+	if structInit(tokens, lexer.CURLYCLOSE) {
 		structure, err := ParseStructInit(tokens)
 
 		if err != nil {
@@ -56,7 +61,7 @@ func ParseAssignment(tokens *lexer.TokenIterator) (codegen.Assignment, error) {
 			return codegen.Assignment{}, err
 		}
 
-		return codegen.Assignment{Ident: ident, Expr: structure, Type: typ}, nil
+		return codegen.Assignment{Ident: ident, Expr: structure, Type: typ, Span: spanFrom(tokens, start.Span)}, nil
 	}
 
 	// get expression
@@ -73,12 +78,12 @@ func ParseAssignment(tokens *lexer.TokenIterator) (codegen.Assignment, error) {
 		return codegen.Assignment{}, err
 	}
 
-	return codegen.Assignment{Ident: ident, Expr: expr, Type: typ}, nil
+	return codegen.Assignment{Ident: ident, Expr: expr, Type: typ, Span: spanFrom(tokens, start.Span)}, nil
 }
 
 func ParseIf(tokens *lexer.TokenIterator) (codegen.If, error) {
 	// get "if"
-	_, err := ExpectToken(tokens, lexer.IF)
+	start, err := ExpectToken(tokens, lexer.IF)
 
 	if err != nil {
 		return codegen.If{}, err
@@ -93,8 +98,9 @@ func ParseIf(tokens *lexer.TokenIterator) (codegen.If, error) {
 
 	// get body
 	body, err := ParseBody(tokens)
+	errs, ok := recovered(err)
 
-	if err != nil {
+	if err != nil && !ok {
 		return codegen.If{}, err
 	}
 
@@ -106,22 +112,26 @@ func ParseIf(tokens *lexer.TokenIterator) (codegen.If, error) {
 			Condition: condition,
 			Body:      body,
 			Else:      nil,
-		}, nil
+			Span:      spanFrom(tokens, start.Span),
+		}, errs.Err()
 	}
 
 	// get else body
 	elseBody, err := ParseBody(tokens)
+	elseErrs, ok := recovered(err)
 
-	if err != nil {
+	if err != nil && !ok {
 		return codegen.If{}, err
 	}
 
-	return codegen.If{Condition: condition, Body: body, Else: elseBody}, nil
+	errs = append(errs, elseErrs...)
+
+	return codegen.If{Condition: condition, Body: body, Else: elseBody, Span: spanFrom(tokens, start.Span)}, errs.Err()
 }
 
 func ParseEscape(tokens *lexer.TokenIterator) (codegen.Escape, error) {
 	// get "escape"
-	_, err := ExpectToken(tokens, lexer.ESCAPE)
+	start, err := ExpectToken(tokens, lexer.ESCAPE)
 
 	if err != nil {
 		return codegen.Escape{}, err
@@ -141,12 +151,12 @@ func ParseEscape(tokens *lexer.TokenIterator) (codegen.Escape, error) {
 		return codegen.Escape{}, err
 	}
 
-	return codegen.Escape{Expr: expr}, nil
+	return codegen.Escape{Expr: expr, Span: spanFrom(tokens, start.Span)}, nil
 }
 
 func ParseProcedure(tokens *lexer.TokenIterator) (codegen.Procedure, error) {
 	// get "proc"
-	_, err := ExpectToken(tokens, lexer.PROC)
+	start, err := ExpectToken(tokens, lexer.PROC)
 
 	if err != nil {
 		return codegen.Procedure{}, err
@@ -159,6 +169,25 @@ func ParseProcedure(tokens *lexer.TokenIterator) (codegen.Procedure, error) {
 		return codegen.Procedure{}, err
 	}
 
+	// a method is declared as Type.method
+	var receiver *codegen.Ident
+
+	if lookahead(tokens, lexer.PERIOD) {
+		_, err = ExpectToken(tokens, lexer.PERIOD)
+
+		if err != nil {
+			return codegen.Procedure{}, err
+		}
+
+		structure := ident
+		receiver = &structure
+		ident, err = ParseIdent(tokens)
+
+		if err != nil {
+			return codegen.Procedure{}, err
+		}
+	}
+
 	// get open parens
 	_, err = ExpectToken(tokens, lexer.PARENOPEN)
 
@@ -197,22 +226,25 @@ func ParseProcedure(tokens *lexer.TokenIterator) (codegen.Procedure, error) {
 
 	// get body
 	body, err := ParseBody(tokens)
+	errs, ok := recovered(err)
 
-	if err != nil {
+	if err != nil && !ok {
 		return codegen.Procedure{}, err
 	}
 
 	return codegen.Procedure{
 		Ident:        ident,
+		Receiver:     receiver,
 		Args:         args,
 		Instructions: body,
 		ReturnType:   returnType,
-	}, nil
+		Span:         spanFrom(tokens, start.Span),
+	}, errs.Err()
 }
 
 func ParseUntil(tokens *lexer.TokenIterator) (codegen.Until, error) {
 	// get "until"
-	_, err := ExpectToken(tokens, lexer.UNTIL)
+	start, err := ExpectToken(tokens, lexer.UNTIL)
 
 	if err != nil {
 		return codegen.Until{}, err
@@ -227,12 +259,13 @@ func ParseUntil(tokens *lexer.TokenIterator) (codegen.Until, error) {
 
 	// get body
 	body, err := ParseBody(tokens)
+	errs, ok := recovered(err)
 
-	if err != nil {
+	if err != nil && !ok {
 		return codegen.Until{}, err
 	}
 
-	return codegen.Until{Condition: condition, Body: body}, nil
+	return codegen.Until{Condition: condition, Body: body, Span: spanFrom(tokens, start.Span)}, errs.Err()
 }
 
 func ParseArg(tokens *lexer.TokenIterator) (codegen.Argument, error) {
@@ -243,6 +276,11 @@ func ParseArg(tokens *lexer.TokenIterator) (codegen.Argument, error) {
 		return codegen.Argument{}, err
 	}
 
+	// the type of self is the struct a method is declared on
+	if ident.Name == "self" && !lookahead(tokens, lexer.COLON) {
+		return codegen.Argument{Ident: ident, Span: ident.Span}, nil
+	}
+
 	// get colon
 	_, err = ExpectToken(tokens, lexer.COLON)
 
@@ -257,10 +295,12 @@ func ParseArg(tokens *lexer.TokenIterator) (codegen.Argument, error) {
 		return codegen.Argument{}, err
 	}
 
-	return codegen.Argument{Ident: ident, Type: typ}, nil
+	return codegen.Argument{Ident: ident, Type: typ, Span: spanFrom(tokens, ident.Span)}, nil
 }
 
-func ParseReassign(tokens *lexer.TokenIterator, path codegen.Path) (codegen.Reassign, error) {
+// ParseReassign parses the rest of an assignment to target, which is a
+// variable, an element of an array or a field of a struct.
+func ParseReassign(tokens *lexer.TokenIterator, target codegen.Expr) (codegen.Reassign, error) {
 	// get equals
 	_, err := ExpectToken(tokens, lexer.ASSIGN)
 
@@ -275,12 +315,12 @@ func ParseReassign(tokens *lexer.TokenIterator, path codegen.Path) (codegen.Reas
 		return codegen.Reassign{}, err
 	}
 
-	return codegen.Reassign{Ident: path, Expr: expr}, nil
+	return codegen.Reassign{Target: target, Expr: expr, Span: spanFrom(tokens, codegen.SpanOf(target))}, nil
 }
 
 func ParseIter(tokens *lexer.TokenIterator) (codegen.Iter, error) {
 	// get "iter"
-	_, err := ExpectToken(tokens, lexer.ITER)
+	start, err := ExpectToken(tokens, lexer.ITER)
 
 	if err != nil {
 		return codegen.Iter{}, err
@@ -293,27 +333,37 @@ func ParseIter(tokens *lexer.TokenIterator) (codegen.Iter, error) {
 		return codegen.Iter{}, err
 	}
 
-	_, err = ExpectToken(tokens, lexer.IN)
+	iter := codegen.Iter{Ident: ident}
+	next, err := tokens.Peek()
 
 	if err != nil {
 		return codegen.Iter{}, err
 	}
 
-	// get lower
-	lower, err := ParseExpr(tokens)
+	// iter i, x in ... counts the iterations in i
+	if next.Kind == lexer.COMMA {
+		_, err = ExpectToken(tokens, lexer.COMMA)
 
-	if err != nil {
-		return codegen.Iter{}, err
+		if err != nil {
+			return codegen.Iter{}, err
+		}
+
+		iter.Index = &ident
+		iter.Ident, err = ParseIdent(tokens)
+
+		if err != nil {
+			return codegen.Iter{}, err
+		}
 	}
 
-	_, err = ExpectToken(tokens, lexer.COLON)
+	_, err = ExpectToken(tokens, lexer.IN)
 
 	if err != nil {
 		return codegen.Iter{}, err
 	}
 
-	// get upper
-	upper, err := ParseExpr(tokens)
+	// get iterable
+	iter.Iterable, err = ParseExpr(tokens)
 
 	if err != nil {
 		return codegen.Iter{}, err
@@ -321,17 +371,21 @@ func ParseIter(tokens *lexer.TokenIterator) (codegen.Iter, error) {
 
 	// get body
 	body, err := ParseBody(tokens)
+	errs, ok := recovered(err)
 
-	if err != nil {
+	if err != nil && !ok {
 		return codegen.Iter{}, err
 	}
 
-	return codegen.Iter{Ident: ident, Lower: lower, Upper: upper, Body: body}, nil
+	iter.Body = body
+	iter.Span = spanFrom(tokens, start.Span)
+
+	return iter, errs.Err()
 }
 
 func ParseBreak(tokens *lexer.TokenIterator) (codegen.Break, error) {
 	// get "break"
-	_, err := ExpectToken(tokens, lexer.BREAK)
+	start, err := ExpectToken(tokens, lexer.BREAK)
 
 	if err != nil {
 		return codegen.Break{}, err
@@ -344,14 +398,14 @@ func ParseBreak(tokens *lexer.TokenIterator) (codegen.Break, error) {
 		return codegen.Break{}, err
 	}
 
-	return codegen.Break{}, nil
+	return codegen.Break{Span: spanFrom(tokens, start.Span)}, nil
 
 }
 
 func ParseContinue(tokens *lexer.TokenIterator) (codegen.Continue, error) {
 
 	// get "continue"
-	_, err := ExpectToken(tokens, lexer.CONTINUE)
+	start, err := ExpectToken(tokens, lexer.CONTINUE)
 
 	if err != nil {
 		return codegen.Continue{}, err
@@ -364,7 +418,7 @@ func ParseContinue(tokens *lexer.TokenIterator) (codegen.Continue, error) {
 		return codegen.Continue{}, err
 	}
 
-	return codegen.Continue{}, nil
+	return codegen.Continue{Span: spanFrom(tokens, start.Span)}, nil
 
 }
 
@@ -401,42 +455,202 @@ func ParseArgs(tokens *lexer.TokenIterator) ([]codegen.Argument, error) {
 	return args, nil
 }
 
-func ParseProcedureCall(tokens *lexer.TokenIterator, path codegen.Path) (codegen.ProcedureCall, error) {
-	// get open parens
-	_, err := ExpectToken(tokens, lexer.PARENOPEN)
+// ParseMatch parses a match, which is both an instruction and an expression.
+func ParseMatch(tokens *lexer.TokenIterator) (codegen.Match, error) {
+	// get "match"
+	start, err := ExpectToken(tokens, lexer.MATCH)
 
 	if err != nil {
-		return codegen.ProcedureCall{}, err
+		return codegen.Match{}, err
 	}
 
-	// get args
+	// get the matched value
+	expr, err := ParseExpr(tokens)
+
+	if err != nil {
+		return codegen.Match{}, err
+	}
+
+	// get open brace
+	_, err = ExpectToken(tokens, lexer.CURLYOPEN)
+
+	if err != nil {
+		return codegen.Match{}, err
+	}
+
+	match := codegen.Match{Expr: expr}
+	var errs diagnostic.List
+
 	next, err := tokens.Peek()
 
 	if err != nil {
-		return codegen.ProcedureCall{}, err
+		return codegen.Match{}, err
 	}
 
-	var args []codegen.Expr
+	// arms...
+	for next.Kind != lexer.CURLYCLOSE {
+		arm, err := ParseMatchArm(tokens)
+		armErrs, ok := recovered(err)
+
+		if err != nil && !ok {
+			return codegen.Match{}, err
+		}
+
+		errs = append(errs, armErrs...)
+		match.Arms = append(match.Arms, arm)
+
+		next, err = tokens.Peek()
+
+		if err != nil {
+			return codegen.Match{}, err
+		}
+	}
+
+	// get close brace
+	_, err = ExpectToken(tokens, lexer.CURLYCLOSE)
+
+	if err != nil {
+		return codegen.Match{}, err
+	}
+
+	match.Span = spanFrom(tokens, start.Span)
+
+	return match, errs.Err()
+}
+
+// ParseMatchArm parses a pattern followed by => and a block, or a single
+// expression and a comma unless it is the last arm.
+func ParseMatchArm(tokens *lexer.TokenIterator) (codegen.MatchArm, error) {
+	pattern, err := ParsePattern(tokens)
 
+	if err != nil {
+		return codegen.MatchArm{}, err
+	}
+
+	// get "=>"
+	_, err = ExpectToken(tokens, lexer.FATARROW)
+
+	if err != nil {
+		return codegen.MatchArm{}, err
+	}
+
+	arm := codegen.MatchArm{Pattern: pattern}
+
+	next, err := tokens.Peek()
+
+	if err != nil {
+		return codegen.MatchArm{}, err
+	}
+
+	if next.Kind == lexer.CURLYOPEN {
+		body, err := ParseBody(tokens)
+		errs, ok := recovered(err)
+
+		if err != nil && !ok {
+			return codegen.MatchArm{}, err
+		}
+
+		arm.Body = body
+		arm.Span = spanFrom(tokens, pattern.Span)
+
+		return arm, errs.Err()
+	}
+
+	arm.Value, err = ParseExpr(tokens)
+
+	if err != nil {
+		return codegen.MatchArm{}, err
+	}
+
+	arm.Span = spanFrom(tokens, pattern.Span)
+
+	next, err = tokens.Peek()
+
+	if err != nil || next.Kind == lexer.CURLYCLOSE {
+		return arm, err
+	}
+
+	// get comma
+	_, err = ExpectToken(tokens, lexer.COMMA)
+
+	if err != nil {
+		return codegen.MatchArm{}, err
+	}
+
+	return arm, nil
+}
+
+// ParsePattern parses _ or the path of a variant, followed by the names its
+// fields are bound to in parentheses if it has any.
+func ParsePattern(tokens *lexer.TokenIterator) (codegen.Pattern, error) {
+	path, err := ParsePath(tokens)
+
+	if err != nil {
+		return codegen.Pattern{}, err
+	}
+
+	if len(path.Tokens) == 1 && path.Tokens[0].Name == "_" {
+		return codegen.Pattern{Span: path.Span}, nil
+	}
+
+	pattern := codegen.Pattern{Variant: &path}
+
+	next, err := tokens.Peek()
+
+	if err != nil {
+		return codegen.Pattern{}, err
+	}
+
+	if next.Kind != lexer.PARENOPEN {
+		pattern.Span = path.Span
+
+		return pattern, nil
+	}
+
+	// get open parens
+	_, err = ExpectToken(tokens, lexer.PARENOPEN)
+
+	if err != nil {
+		return codegen.Pattern{}, err
+	}
+
+	next, err = tokens.Peek()
+
+	if err != nil {
+		return codegen.Pattern{}, err
+	}
+
+	// bindings...
 	for next.Kind != lexer.PARENCLOSE {
-		arg, err := ParseExpr(tokens)
+		ident, err := ParseIdent(tokens)
 
 		if err != nil {
-			return codegen.ProcedureCall{}, err
+			return codegen.Pattern{}, err
 		}
 
-		args = append(args, arg)
+		pattern.Bindings = append(pattern.Bindings, ident)
 
 		next, err = tokens.Peek()
 
 		if err != nil {
-			return codegen.ProcedureCall{}, err
+			return codegen.Pattern{}, err
 		}
 
+		if next.Kind == lexer.PARENCLOSE {
+			break
+		}
+
+		// get comma
 		_, err = ExpectToken(tokens, lexer.COMMA)
 
 		if err != nil {
-			break
+			return codegen.Pattern{}, err
+		}
+
+		next, err = tokens.Peek()
+
+		if err != nil {
+			return codegen.Pattern{}, err
 		}
 	}
 
@@ -444,8 +658,10 @@ func ParseProcedureCall(tokens *lexer.TokenIterator, path codegen.Path) (codegen
 	_, err = ExpectToken(tokens, lexer.PARENCLOSE)
 
 	if err != nil {
-		return codegen.ProcedureCall{}, err
+		return codegen.Pattern{}, err
 	}
 
-	return codegen.ProcedureCall{Ident: path, Args: args}, nil
+	pattern.Span = spanFrom(tokens, path.Span)
+
+	return pattern, nil
 }
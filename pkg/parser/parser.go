@@ -1,15 +1,16 @@
 package parser
 
 import (
-	"fmt"
+	"strconv"
 
 	"github.com/whirl-lang/whirl/pkg/codegen"
+	"github.com/whirl-lang/whirl/pkg/diagnostic"
 	"github.com/whirl-lang/whirl/pkg/lexer"
 )
 
 func ParseImport(tokens *lexer.TokenIterator) (codegen.Import, error) {
 	// get "import"
-	_, err := ExpectToken(tokens, lexer.IMPORT)
+	start, err := ExpectToken(tokens, lexer.IMPORT)
 
 	if err != nil {
 		return codegen.Import{}, err
@@ -29,18 +30,33 @@ func ParseImport(tokens *lexer.TokenIterator) (codegen.Import, error) {
 		return codegen.Import{}, err
 	}
 
-	return codegen.Import{Path: path.Value[1 : len(path.Value)-1]}, nil
+	return codegen.Import{
+		Path: path.Value,
+		Span: spanFrom(tokens, start.Span),
+	}, nil
 }
 
+// ParseBody parses a block of instructions. Syntax errors inside the block
+// are recovered from, in which case the instructions that could be parsed are
+// returned along with a diagnostic.List.
 func ParseBody(tokens *lexer.TokenIterator) ([]codegen.Instruction, error) {
 	// parse curly open
-	_, err := ExpectToken(tokens, lexer.CURLYOPEN)
+	open, err := ExpectToken(tokens, lexer.CURLYOPEN)
 
 	if err != nil {
 		// parse one instruction
-		instruction, err := ParseInstruction(tokens)
+		instruction, instructionErr := ParseInstruction(tokens)
 
-		if err != nil {
+		if list, ok := recovered(instructionErr); ok {
+			return []codegen.Instruction{instruction}, list
+		}
+
+		if instructionErr != nil {
+			return nil, instructionErr
+		}
+
+		// reached the end of the file
+		if instruction == nil {
 			return nil, err
 		}
 
@@ -48,27 +64,37 @@ func ParseBody(tokens *lexer.TokenIterator) ([]codegen.Instruction, error) {
 	}
 
 	var instructions []codegen.Instruction
+	var errs diagnostic.List
 
-	next, err := tokens.Peek()
-
-	if err != nil {
-		return nil, err
-	}
+	next := peek(tokens, &errs)
 
 	for next.Kind != lexer.CURLYCLOSE {
-		instruction, err := ParseInstruction(tokens)
+		if next.Kind == lexer.EOF {
+			errs = append(errs, diagnostic.Errorf(next.Span, "expected }, got EOF").
+				WithNote("the block opened on line %d is never closed", open.Span.Start.Line))
 
-		if err != nil {
-			return nil, err
+			return instructions, errs
 		}
 
-		instructions = append(instructions, instruction)
+		offset := tokens.Position.Offset
+		instruction, err := ParseInstruction(tokens)
 
-		next, err = tokens.Peek()
+		if list, ok := recovered(err); ok {
+			errs = append(errs, list...)
+			instructions = append(instructions, instruction)
+		} else if err != nil {
+			errs = append(errs, diagnostic.FromError(err))
+			errs = append(errs, synchronize(tokens)...)
 
-		if err != nil {
-			return nil, err
+			// make sure a token that can't start anything is skipped
+			if tokens.Position.Offset == offset {
+				tokens.Next()
+			}
+		} else {
+			instructions = append(instructions, instruction)
 		}
+
+		next = peek(tokens, &errs)
 	}
 
 	// parse curly close
@@ -78,7 +104,7 @@ func ParseBody(tokens *lexer.TokenIterator) ([]codegen.Instruction, error) {
 		return nil, err
 	}
 
-	return instructions, nil
+	return instructions, errs.Err()
 }
 
 func ParseInstruction(tokens *lexer.TokenIterator) (codegen.Instruction, error) {
@@ -97,6 +123,10 @@ func ParseInstruction(tokens *lexer.TokenIterator) (codegen.Instruction, error)
 		return ParseContinue(tokens)
 	case lexer.STRUCT:
 		return ParseStruct(tokens)
+	case lexer.ENUM:
+		return ParseEnum(tokens)
+	case lexer.MATCH:
+		return ParseMatch(tokens)
 	case lexer.IF:
 		return ParseIf(tokens)
 	case lexer.ESCAPE:
@@ -109,22 +139,26 @@ func ParseInstruction(tokens *lexer.TokenIterator) (codegen.Instruction, error)
 		return ParseIter(tokens)
 	case lexer.IMPORT:
 		return ParseImport(tokens)
-	case lexer.IDENT:
-		path, err := ParsePath(tokens)
+	case lexer.IDENT, lexer.MUL:
+		expr, err := ParseExpr(tokens)
 
 		if err != nil {
-			return codegen.ProcedureCall{}, err
+			return nil, err
 		}
 
 		var instruction codegen.Instruction
-		instruction, err = ParseProcedureCall(tokens, path)
 
-		if err != nil {
-			instruction, err = ParseReassign(tokens, path)
+		switch expr := expr.(type) {
+		case codegen.Call:
+			instruction = expr
+		case codegen.Ident, codegen.Index, codegen.FieldAccess, codegen.Deref:
+			instruction, err = ParseReassign(tokens, expr)
+		default:
+			err = diagnostic.Errorf(next.Span, "expected an instruction, got an expression")
+		}
 
-			if err != nil {
-				return nil, err
-			}
+		if err != nil {
+			return nil, err
 		}
 
 		_, err = ExpectToken(tokens, lexer.SEMICOLON)
@@ -136,13 +170,89 @@ func ParseInstruction(tokens *lexer.TokenIterator) (codegen.Instruction, error)
 		return instruction, nil
 	}
 
-	_, err = ExpectToken(tokens, lexer.EOF)
+	if next.Kind != lexer.EOF {
+		return nil, diagnostic.Errorf(next.Span, "expected an instruction, got %s", lexer.TokensPretty[next.Kind])
+	}
+
+	return nil, nil
+}
+
+// parseVec parses the element type of a vector type, after Vec.
+func parseVec(tokens *lexer.TokenIterator, start lexer.Token) (codegen.Vec, error) {
+	_, err := ExpectToken(tokens, lexer.LT)
 
 	if err != nil {
-		return nil, err
+		return codegen.Vec{}, err
 	}
 
-	return nil, nil
+	element, err := ParseType(tokens)
+
+	if err != nil {
+		return codegen.Vec{}, err
+	}
+
+	_, err = ExpectToken(tokens, lexer.GT)
+
+	if err != nil {
+		return codegen.Vec{}, err
+	}
+
+	return codegen.Vec{Type: element, Span: spanFrom(tokens, start.Span)}, nil
+}
+
+// parseMap parses the key and value types of a map type, after map.
+func parseMap(tokens *lexer.TokenIterator, start lexer.Token) (codegen.Map, error) {
+	_, err := ExpectToken(tokens, lexer.LT)
+
+	if err != nil {
+		return codegen.Map{}, err
+	}
+
+	key, err := ParseType(tokens)
+
+	if err != nil {
+		return codegen.Map{}, err
+	}
+
+	_, err = ExpectToken(tokens, lexer.COMMA)
+
+	if err != nil {
+		return codegen.Map{}, err
+	}
+
+	value, err := ParseType(tokens)
+
+	if err != nil {
+		return codegen.Map{}, err
+	}
+
+	_, err = ExpectToken(tokens, lexer.GT)
+
+	if err != nil {
+		return codegen.Map{}, err
+	}
+
+	return codegen.Map{Key: key, Value: value, Span: spanFrom(tokens, start.Span)}, nil
+}
+
+// parseNumber returns the number type an identifier names, or nil if it
+// doesn't name one. Besides int, number types aren't keywords, so they can
+// still name variables.
+func parseNumber(tok lexer.Token) codegen.Type {
+	switch tok.Value {
+	case "float":
+		return codegen.Float{Span: tok.Span}
+	case "f32", "f64":
+		bits, _ := strconv.Atoi(tok.Value[1:])
+
+		return codegen.Float{Bits: bits, Span: tok.Span}
+	case "i8", "i16", "i32", "i64", "u8", "u16", "u32", "u64":
+		bits, _ := strconv.Atoi(tok.Value[1:])
+
+		return codegen.Int{Bits: bits, Unsigned: tok.Value[0] == 'u', Span: tok.Span}
+	}
+
+	return nil
 }
 
 func ParseType(tokens *lexer.TokenIterator) (codegen.Type, error) {
@@ -156,28 +266,95 @@ func ParseType(tokens *lexer.TokenIterator) (codegen.Type, error) {
 
 	switch tok.Kind {
 	case lexer.INT:
-		typ = codegen.Int{}
+		typ = codegen.Int{Span: tok.Span}
 	case lexer.STRING:
-		typ = codegen.String{}
+		typ = codegen.String{Span: tok.Span}
 	case lexer.BOOLEAN:
-		typ = codegen.Bool{}
+		typ = codegen.Bool{Span: tok.Span}
 	case lexer.CHAR:
-		typ = codegen.Char{}
+		typ = codegen.Char{Span: tok.Span}
 	case lexer.VOID:
-		typ = codegen.Void{}
+		typ = codegen.Void{Span: tok.Span}
+	case lexer.REF:
+		// &int[] is a reference to an array
+		mutable := lookahead(tokens, lexer.MUT)
+
+		if mutable {
+			_, err = ExpectToken(tokens, lexer.MUT)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		referred, err := ParseType(tokens)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return codegen.Reference{Type: referred, Mutable: mutable, Span: spanFrom(tokens, tok.Span)}, nil
 	case lexer.IDENT:
-		typ = codegen.Ident{Name: tok.Value}
+		if number := parseNumber(tok); number != nil {
+			typ = number
+
+			break
+		}
+
+		// like the number types, range isn't a keyword
+		if tok.Value == "range" {
+			typ = codegen.Range{Span: tok.Span}
+
+			break
+		}
+
+		typ = codegen.Ident{Name: tok.Value, Span: tok.Span}
+
+		next, err := tokens.Peek()
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Vec and map are only types with the types of their elements,
+		// like Vec<int> and map<string, int>
+		switch {
+		case tok.Value == "Vec" && next.Kind == lexer.LT:
+			typ, err = parseVec(tokens, tok)
+		case tok.Value == "map" && next.Kind == lexer.LT:
+			typ, err = parseMap(tokens, tok)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		// a struct from another module
+		if next.Kind == lexer.COLONCOLON {
+			path, err := parsePathFrom(tokens, tok)
+
+			if err != nil {
+				return nil, err
+			}
+
+			typ = path
+		}
 	default:
-		return nil, fmt.Errorf("unexpected token %s", lexer.TokensPretty[tok.Kind])
+		return nil, diagnostic.Errorf(tok.Span, "expected a type, got %s", lexer.TokensPretty[tok.Kind])
 	}
 
-	tok, err = tokens.Peek()
+	// int[][] is an array of arrays of ints
+	for {
+		tok, err = tokens.Peek()
 
-	if err != nil {
-		return nil, err
-	}
+		if err != nil {
+			return nil, err
+		}
+
+		if tok.Kind != lexer.BRACKETOPEN {
+			return typ, nil
+		}
 
-	if tok.Kind == lexer.BRACKETOPEN {
 		_, err = ExpectToken(tokens, lexer.BRACKETOPEN)
 
 		if err != nil {
@@ -192,10 +369,8 @@ func ParseType(tokens *lexer.TokenIterator) (codegen.Type, error) {
 			return nil, err
 		}
 
-		typ = codegen.Array{Type: typ}
+		typ = codegen.Array{Type: typ, Span: spanFrom(tokens, tok.Span)}
 	}
-
-	return typ, nil
 }
 
 func ParseIdent(tokens *lexer.TokenIterator) (codegen.Ident, error) {
@@ -205,7 +380,7 @@ func ParseIdent(tokens *lexer.TokenIterator) (codegen.Ident, error) {
 		return codegen.Ident{}, err
 	}
 
-	return codegen.Ident{Name: token.Value}, nil
+	return codegen.Ident{Name: token.Value, Span: token.Span}, nil
 }
 
 func ParsePath(tokens *lexer.TokenIterator) (codegen.Path, error) {
@@ -215,6 +390,12 @@ func ParsePath(tokens *lexer.TokenIterator) (codegen.Path, error) {
 		return codegen.Path{}, err
 	}
 
+	return parsePathFrom(tokens, token)
+}
+
+// parsePathFrom parses the rest of a path whose first identifier was already
+// consumed.
+func parsePathFrom(tokens *lexer.TokenIterator, token lexer.Token) (codegen.Path, error) {
 	next, err := tokens.Peek()
 
 	if err != nil {
@@ -222,7 +403,8 @@ func ParsePath(tokens *lexer.TokenIterator) (codegen.Path, error) {
 	}
 
 	path := codegen.Path{
-		Tokens: []codegen.Ident{{Name: token.Value}},
+		Tokens: []codegen.Ident{{Name: token.Value, Span: token.Span}},
+		Span:   token.Span,
 	}
 
 	for next.Kind == lexer.COLONCOLON {
@@ -238,7 +420,8 @@ func ParsePath(tokens *lexer.TokenIterator) (codegen.Path, error) {
 			return codegen.Path{}, err
 		}
 
-		path.Tokens = append(path.Tokens, codegen.Ident{Name: token.Value})
+		path.Tokens = append(path.Tokens, codegen.Ident{Name: token.Value, Span: token.Span})
+		path.Span = path.Span.To(token.Span)
 
 		next, err = tokens.Peek()
 
@@ -250,6 +433,11 @@ func ParsePath(tokens *lexer.TokenIterator) (codegen.Path, error) {
 	return path, nil
 }
 
+// spanFrom returns a span from start to the end of the last consumed token.
+func spanFrom(tokens *lexer.TokenIterator, start lexer.Span) lexer.Span {
+	return start.To(tokens.Previous.Span)
+}
+
 func ExpectToken(tokens *lexer.TokenIterator, token int) (lexer.Token, error) {
 	tok, err := tokens.Peek()
 
@@ -258,18 +446,142 @@ func ExpectToken(tokens *lexer.TokenIterator, token int) (lexer.Token, error) {
 	}
 
 	if tok.Kind != token {
-		return tok, fmt.Errorf("expected %s, got %s", lexer.TokensPretty[token], lexer.TokensPretty[tok.Kind])
+		err := diagnostic.Errorf(tok.Span, "expected %s, got %s", lexer.TokensPretty[token], lexer.TokensPretty[tok.Kind])
+
+		if token == lexer.SEMICOLON {
+			end := tokens.Previous.Span
+			end.Start = end.End
+
+			// point at the end of the line that is missing its semicolon
+			if end.End.Line < tok.Span.Start.Line {
+				err.Span = end
+			}
+
+			err = err.WithFix(end, ";", "add a semicolon")
+		}
+
+		return tok, err
 	}
 
 	return tokens.Next()
 }
 
+// recovered reports whether err comes from a parse that resynchronized after
+// its errors, meaning the node returned alongside it can still be used.
+func recovered(err error) (diagnostic.List, bool) {
+	list, ok := err.(diagnostic.List)
+
+	return list, ok && len(list) > 0
+}
+
+// peek returns the next token, collecting lexer errors into errs instead of
+// giving up on them.
+func peek(tokens *lexer.TokenIterator, errs *diagnostic.List) lexer.Token {
+	for {
+		next, err := tokens.Peek()
+
+		if err == nil {
+			return next
+		}
+
+		*errs = append(*errs, diagnostic.FromError(err))
+	}
+}
+
+// synchronize skips tokens until parsing can resume: after a semicolon, before
+// a closing brace or before a keyword that starts an instruction. Blocks
+// opened while skipping are skipped as a whole. Lexer errors found on the way
+// are returned.
+func synchronize(tokens *lexer.TokenIterator) diagnostic.List {
+	var errs diagnostic.List
+	depth := 0
+
+	for {
+		next := peek(tokens, &errs)
+
+		switch next.Kind {
+		case lexer.EOF, lexer.PROC, lexer.STRUCT, lexer.ENUM, lexer.IMPORT:
+			return errs
+		case lexer.LET, lexer.IF, lexer.UNTIL, lexer.ITER, lexer.MATCH, lexer.ESCAPE, lexer.BREAK, lexer.CONTINUE:
+			if depth == 0 {
+				return errs
+			}
+		case lexer.CURLYOPEN:
+			depth++
+		case lexer.CURLYCLOSE:
+			if depth == 0 {
+				return errs
+			}
+
+			depth--
+
+			if depth == 0 {
+				tokens.Next()
+
+				return errs
+			}
+		case lexer.SEMICOLON:
+			if depth == 0 {
+				tokens.Next()
+
+				return errs
+			}
+		}
+
+		tokens.Next()
+	}
+}
+
 type InstructionIterator struct {
 	Tokens lexer.TokenIterator
 }
 
+// Next parses the next top-level instruction and returns nil at the end of
+// the file. After a syntax error the iterator resynchronizes, so Next can be
+// called again to continue with the rest of the file. A diagnostic.List may
+// be returned together with a partial instruction.
 func (iter *InstructionIterator) Next() (codegen.Instruction, error) {
-	return ParseInstruction(&iter.Tokens)
+	offset := iter.Tokens.Position.Offset
+	instruction, err := ParseInstruction(&iter.Tokens)
+
+	if _, ok := recovered(err); ok || err == nil {
+		return instruction, err
+	}
+
+	errs := diagnostic.List{diagnostic.FromError(err)}
+	errs = append(errs, synchronize(&iter.Tokens)...)
+
+	// a stray closing brace doesn't end anything at the top level
+	next := peek(&iter.Tokens, &errs)
+
+	if next.Kind == lexer.CURLYCLOSE || iter.Tokens.Position.Offset == offset {
+		iter.Tokens.Next()
+	}
+
+	return nil, errs
+}
+
+// Parse parses every instruction in tokens. Syntax errors are reported into
+// diags and the parser resynchronizes after them, so the returned
+// instructions form a partial AST even when diags has errors.
+func Parse(tokens lexer.TokenIterator, diags *diagnostic.Collector) []codegen.Instruction {
+	iter := Iterator(tokens)
+
+	var instructions []codegen.Instruction
+
+	for {
+		instruction, err := iter.Next()
+
+		if err != nil {
+			diags.ReportError(err)
+		}
+
+		if instruction != nil {
+			instructions = append(instructions, instruction)
+		} else if err == nil {
+			return instructions
+		}
+	}
 }
 
 func Iterator(tokens lexer.TokenIterator) InstructionIterator {
@@ -1,8 +1,11 @@
 package parser
 
 import (
+	"math"
 	"testing"
 
+	"github.com/whirl-lang/whirl/pkg/codegen"
+	"github.com/whirl-lang/whirl/pkg/diagnostic"
 	"github.com/whirl-lang/whirl/pkg/lexer"
 )
 
@@ -22,6 +25,14 @@ func TestParserVariables(t *testing.T) {
 	}
 }
 
+func TestParserInferredVariables(t *testing.T) {
+	err := CheckForErrorsInIterator([]byte("proc main() :: int { let a = 5; let p = Point { x: a, }; escape 0; }"))
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
 func TestParserArray(t *testing.T) {
 	err := CheckForErrorsInIterator([]byte("proc main() :: int { let a: int[] = [1, 2, 3, 4, 5]; escape 0; }"))
 
@@ -30,6 +41,37 @@ func TestParserArray(t *testing.T) {
 	}
 }
 
+func TestParserNestedArrayTypes(t *testing.T) {
+	tokens := lexer.Iterator([]byte(`int[][]`))
+	typ, err := ParseType(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	outer, ok := typ.(codegen.Array)
+
+	if !ok {
+		t.Fatalf("expected an array of arrays, got %#v", typ)
+	}
+
+	inner, ok := outer.Type.(codegen.Array)
+
+	if !ok {
+		t.Fatalf("expected an array, got %#v", outer.Type)
+	}
+
+	if _, ok := inner.Type.(codegen.Int); !ok {
+		t.Fatalf("expected an array of ints, got %#v", inner)
+	}
+
+	err = CheckForErrorsInIterator([]byte("proc f(grid: int[][]) :: int[][] { escape grid; } proc main() :: int { let g: int[][] = [[1]]; escape 0; }"))
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
 func TestParserIf(t *testing.T) {
 	err := CheckForErrorsInIterator([]byte("proc main() :: int { if 5 == 5 { escape 0; } escape 0; }"))
 
@@ -38,6 +80,122 @@ func TestParserIf(t *testing.T) {
 	}
 }
 
+func TestParserSpans(t *testing.T) {
+	lexerIterator := lexer.Iterator([]byte("proc main() :: int {\n  let a: int = 5;\n  escape a;\n}"))
+	instructionIterator := Iterator(lexerIterator)
+
+	instruction, err := instructionIterator.Next()
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	procedure := instruction.(codegen.Procedure)
+
+	if procedure.Span.Start.Line != 1 || procedure.Span.End.Line != 4 {
+		t.Fatalf("expected procedure to span lines 1-4, got %d-%d", procedure.Span.Start.Line, procedure.Span.End.Line)
+	}
+
+	assignment := procedure.Instructions[0].(codegen.Assignment)
+
+	if assignment.Span.Start.Line != 2 || assignment.Span.Start.Column != 3 || assignment.Span.End.Column != 18 {
+		t.Fatalf("unexpected assignment span %v", assignment.Span)
+	}
+}
+
+func TestParserMissingSemicolon(t *testing.T) {
+	err := CheckForErrorsInIterator([]byte("proc main() :: int {\n  let a: int = 5\n  escape a;\n}"))
+
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	d := diagnostic.FromError(err)
+
+	if d.Span.Start.Line != 2 || d.Span.Start.Column != 17 {
+		t.Fatalf("expected error at 2:17, got %d:%d", d.Span.Start.Line, d.Span.Start.Column)
+	}
+
+	if len(d.Fixes) != 1 || d.Fixes[0].Replacement != ";" {
+		t.Fatalf("expected a fix inserting a semicolon, got %v", d.Fixes)
+	}
+}
+
+func TestParserRecovery(t *testing.T) {
+	diags := diagnostic.NewCollector()
+	instructions := Parse(lexer.Iterator([]byte(`
+proc first() :: int {
+	let a: int = 5
+	if a == 5 { escape 1; }
+	escape a;
+}
+
+}
+
+proc second() :: void {
+	let b: = 4;
+}
+
+proc main() :: int {
+	escape 0;
+`)), diags)
+
+	if diags.Errors() != 4 {
+		t.Fatalf("expected 4 errors, got %d: %v", diags.Errors(), diags.Diagnostics)
+	}
+
+	if len(instructions) != 3 {
+		t.Fatalf("expected 3 procedures in the partial AST, got %d", len(instructions))
+	}
+
+	first := instructions[0].(codegen.Procedure)
+
+	if len(first.Instructions) != 2 {
+		t.Fatalf("expected the if and escape of first to be recovered, got %d instructions", len(first.Instructions))
+	}
+}
+
+func TestParserPrecedence(t *testing.T) {
+	tokens := lexer.Iterator([]byte("1 + 2 * 3 == 7 && !done || f(a)[0].x % 2 < 1"))
+	expr, err := ParseExpr(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// ((1 + (2 * 3)) == 7 && !done) || ((f(a)[0].x % 2) < 1)
+	or := expr.(codegen.Binary)
+
+	if or.Op != lexer.OR {
+		t.Fatalf("expected || at the root, got %s", lexer.TokensPretty[or.Op])
+	}
+
+	and := or.Left.(codegen.Binary)
+	eq := and.Left.(codegen.Binary)
+	plus := eq.Left.(codegen.Binary)
+
+	if and.Op != lexer.AND || eq.Op != lexer.EQ || plus.Op != lexer.PLUS || plus.Right.(codegen.Binary).Op != lexer.MUL {
+		t.Fatalf("unexpected left side %#v", and)
+	}
+
+	if and.Right.(codegen.Unary).Op != lexer.NOT {
+		t.Fatalf("expected ! on the right of &&")
+	}
+
+	lt := or.Right.(codegen.Binary)
+	mod := lt.Left.(codegen.Binary)
+	field := mod.Left.(codegen.FieldAccess)
+	index := field.Expr.(codegen.Index)
+
+	if lt.Op != lexer.LT || mod.Op != lexer.MOD || field.Field.Name != "x" {
+		t.Fatalf("unexpected right side %#v", lt)
+	}
+
+	if _, ok := index.Expr.(codegen.Call); !ok {
+		t.Fatalf("expected a call to be indexed, got %#v", index.Expr)
+	}
+}
+
 func CheckForErrorsInIterator(input []byte) error {
 	lexerIterator := lexer.Iterator([]byte(input))
 	instructionIterator := Iterator(lexerIterator)
@@ -55,3 +213,344 @@ func CheckForErrorsInIterator(input []byte) error {
 	}
 
 }
+
+func TestParserPostfixChains(t *testing.T) {
+	tokens := lexer.Iterator([]byte("b::sum(Point { x: 1, }.x, grid[i][j]) + p.to.y"))
+	expr, err := ParseExpr(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	plus := expr.(codegen.Binary)
+	call := plus.Left.(codegen.Call)
+
+	if callee := call.Callee.(codegen.Path); len(callee.Tokens) != 2 || callee.Tokens[1].Name != "sum" {
+		t.Fatalf("expected a call to b::sum, got %#v", call.Callee)
+	}
+
+	if _, ok := call.Args[0].(codegen.FieldAccess).Expr.(codegen.StructInit); !ok {
+		t.Fatalf("expected a field of a struct initializer, got %#v", call.Args[0])
+	}
+
+	if _, ok := call.Args[1].(codegen.Index).Expr.(codegen.Index); !ok {
+		t.Fatalf("expected a nested index, got %#v", call.Args[1])
+	}
+
+	if field := plus.Right.(codegen.FieldAccess); field.Field.Name != "y" {
+		t.Fatalf("expected access to y, got %#v", field)
+	}
+}
+
+func TestParserStructInitPaths(t *testing.T) {
+	tokens := lexer.Iterator([]byte("geometry::Point { x: 1, y: 2, }"))
+	expr, err := ParseExpr(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	init, ok := expr.(codegen.StructInit)
+
+	if !ok || len(init.Path.Tokens) != 2 || init.Path.Tokens[1].Name != "Point" || len(init.Fields) != 2 {
+		t.Fatalf("expected an initializer of geometry::Point, got %#v", expr)
+	}
+
+	err = CheckForErrorsInIterator([]byte("proc main() :: int { let e = shapes::Empty {}; if b::done {} escape 0; }"))
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestParserReassignTargets(t *testing.T) {
+	err := CheckForErrorsInIterator([]byte("proc main() :: int { p.x = 1; values[0] = 2; grid[1][2] = p.y; escape 0; }"))
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestParserBlockAfterIdent(t *testing.T) {
+	err := CheckForErrorsInIterator([]byte("proc main() :: int { until done {} if ok { escape 1; } escape 0; }"))
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestParserIterForms(t *testing.T) {
+	tokens := lexer.Iterator([]byte("proc main() :: int { iter i, x in values {} iter c in 0:len(s) + 1 {} escape 0; }"))
+	procedure, err := ParseProcedure(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	pairs := procedure.Instructions[0].(codegen.Iter)
+
+	if pairs.Index == nil || pairs.Index.Name != "i" || pairs.Ident.Name != "x" {
+		t.Fatalf("expected iter i, x, got %#v", pairs)
+	}
+
+	numbers := procedure.Instructions[1].(codegen.Iter)
+
+	if numbers.Index != nil {
+		t.Fatalf("expected no index, got %#v", numbers.Index)
+	}
+
+	if _, ok := numbers.Iterable.(codegen.Range).Upper.(codegen.Binary); !ok {
+		t.Fatalf("expected a range up to a sum, got %#v", numbers.Iterable)
+	}
+}
+
+func TestParserRanges(t *testing.T) {
+	tokens := lexer.Iterator([]byte("10..=n - 1 step -2"))
+	expr, err := ParseExpr(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	r := expr.(codegen.Range)
+
+	if !r.Inclusive {
+		t.Fatalf("expected an inclusive range, got %#v", r)
+	}
+
+	if _, ok := r.Upper.(codegen.Binary); !ok {
+		t.Fatalf("expected the upper bound to be n - 1, got %#v", r.Upper)
+	}
+
+	if _, ok := r.Step.(codegen.Unary); !ok {
+		t.Fatalf("expected a step of -2, got %#v", r.Step)
+	}
+
+	err = CheckForErrorsInIterator([]byte("proc main() :: int { let step = 2; iter i in 0:10 step step {} escape 0; }"))
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestParserEnumAndMatch(t *testing.T) {
+	tokens := lexer.Iterator([]byte(`enum Shape { Circle(radius: int), Rect(w: int, h: int), Empty, }`))
+	enum, err := ParseEnum(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if len(enum.Variants) != 3 || len(enum.Variants[1].Fields) != 2 || len(enum.Variants[2].Fields) != 0 {
+		t.Fatalf("expected variants with 1, 2 and 0 fields, got %#v", enum.Variants)
+	}
+
+	tokens = lexer.Iterator([]byte(`match s { Shape::Circle(r) => r, Shape::Rect(w, _) => { printf("%d", w); } _ => 0 }`))
+	expr, err := ParseExpr(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	match := expr.(codegen.Match)
+
+	if len(match.Arms) != 3 {
+		t.Fatalf("expected 3 arms, got %#v", match.Arms)
+	}
+
+	if match.Arms[0].Value == nil || len(match.Arms[1].Body) != 1 || match.Arms[2].Pattern.Variant != nil {
+		t.Fatalf("expected a value, a block and a _ arm, got %#v", match.Arms)
+	}
+
+	if bindings := match.Arms[1].Pattern.Bindings; len(bindings) != 2 || bindings[1].Name != "_" {
+		t.Fatalf("expected the bindings w, _, got %#v", bindings)
+	}
+}
+
+func TestParserMethods(t *testing.T) {
+	tokens := lexer.Iterator([]byte(`proc Point.add(self, other: Point) :: Point { escape self; }`))
+	procedure, err := ParseProcedure(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if procedure.Receiver == nil || procedure.Receiver.Name != "Point" || procedure.Ident.Name != "add" {
+		t.Fatalf("expected the method Point.add, got %#v", procedure)
+	}
+
+	if len(procedure.Args) != 2 || procedure.Args[0].Type != nil || procedure.Args[1].Type == nil {
+		t.Fatalf("expected an untyped self and a typed argument, got %#v", procedure.Args)
+	}
+
+	tokens = lexer.Iterator([]byte(`p.add(q).x`))
+	expr, err := ParseExpr(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	call := expr.(codegen.FieldAccess).Expr.(codegen.Call)
+
+	if callee, ok := call.Callee.(codegen.FieldAccess); !ok || callee.Field.Name != "add" {
+		t.Fatalf("expected a call of p.add, got %#v", call)
+	}
+}
+
+func TestParserReferences(t *testing.T) {
+	tokens := lexer.Iterator([]byte(`proc swap(a: &mut int, b: &int[]) :: void { *a = *b[0]; }`))
+	procedure, err := ParseProcedure(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	a := procedure.Args[0].Type.(codegen.Reference)
+	b := procedure.Args[1].Type.(codegen.Reference)
+
+	if !a.Mutable || b.Mutable {
+		t.Fatalf("expected &mut int and &int[], got %#v and %#v", a, b)
+	}
+
+	if _, ok := b.Type.(codegen.Array); !ok {
+		t.Fatalf("expected a reference to an array, got %#v", b)
+	}
+
+	reassign := procedure.Instructions[0].(codegen.Reassign)
+
+	if _, ok := reassign.Target.(codegen.Deref); !ok {
+		t.Fatalf("expected to assign to *a, got %#v", reassign.Target)
+	}
+
+	tokens = lexer.Iterator([]byte(`&mut p.x`))
+	expr, err := ParseExpr(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if address, ok := expr.(codegen.AddressOf); !ok || !address.Mutable {
+		t.Fatalf("expected a mutable reference, got %#v", expr)
+	}
+}
+
+func TestParserVecTypes(t *testing.T) {
+	tokens := lexer.Iterator([]byte(`Vec<Vec<int>>[]`))
+	typ, err := ParseType(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	array, ok := typ.(codegen.Array)
+
+	if !ok {
+		t.Fatalf("expected an array of vectors, got %#v", typ)
+	}
+
+	outer, ok := array.Type.(codegen.Vec)
+
+	if !ok {
+		t.Fatalf("expected a vector, got %#v", array.Type)
+	}
+
+	if _, ok := outer.Type.(codegen.Vec); !ok {
+		t.Fatalf("expected a vector of vectors, got %#v", outer)
+	}
+}
+
+func TestParserMaps(t *testing.T) {
+	tokens := lexer.Iterator([]byte(`map<string, Vec<int>>`))
+	typ, err := ParseType(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	m, ok := typ.(codegen.Map)
+
+	if !ok {
+		t.Fatalf("expected a map, got %#v", typ)
+	}
+
+	if _, ok := m.Value.(codegen.Vec); !ok {
+		t.Fatalf("expected values of type Vec<int>, got %#v", m.Value)
+	}
+
+	tokens = lexer.Iterator([]byte(`{"a": 0:10, "b" : n + 1,}`))
+	expr, err := ParseExpr(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	m = expr.(codegen.Map)
+
+	if len(m.Keys) != 2 || len(m.Values) != 2 {
+		t.Fatalf("expected 2 entries, got %#v", m)
+	}
+
+	if _, ok := m.Values[0].(codegen.Range); !ok {
+		t.Fatalf("expected a range value, got %#v", m.Values[0])
+	}
+}
+
+func TestParserNumbers(t *testing.T) {
+	tokens := lexer.Iterator([]byte("0xff + 1.5e3 as i64 * 2 as f32"))
+	expr, err := ParseExpr(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// 0xff + ((1.5e3 as i64) * (2 as f32))
+	plus := expr.(codegen.Binary)
+
+	if value := plus.Left.(codegen.Literal).Value.(codegen.Int).Value; value != 255 {
+		t.Fatalf("expected 255, got %d", value)
+	}
+
+	mul := plus.Right.(codegen.Binary)
+	left := mul.Left.(codegen.Cast)
+	right := mul.Right.(codegen.Cast)
+
+	if value := left.Expr.(codegen.Literal).Value.(codegen.Float).Value; value != 1500 {
+		t.Fatalf("expected 1500, got %v", value)
+	}
+
+	if typ := left.Type.(codegen.Int); typ.Bits != 64 || typ.Unsigned {
+		t.Fatalf("expected i64, got %#v", typ)
+	}
+
+	if typ := right.Type.(codegen.Float); typ.Bits != 32 {
+		t.Fatalf("expected f32, got %#v", typ)
+	}
+
+	tokens = lexer.Iterator([]byte("u8[]"))
+	typ, err := ParseType(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if element := typ.(codegen.Array).Type.(codegen.Int); element.Bits != 8 || !element.Unsigned {
+		t.Fatalf("expected an array of u8, got %#v", typ)
+	}
+
+	tokens = lexer.Iterator([]byte("0xFFFF_FFFF_FFFF_FFFF"))
+	expr, err = ParseExpr(&tokens)
+
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if value := expr.(codegen.Literal).Value.(codegen.Int).Value; value != math.MaxUint64 {
+		t.Fatalf("expected the largest u64, got %d", value)
+	}
+
+	tokens = lexer.Iterator([]byte("99999999999999999999"))
+
+	if _, err := ParseExpr(&tokens); err == nil {
+		t.Fatalf("expected an error for an int that is too large")
+	}
+}
@@ -7,7 +7,7 @@ import (
 
 func ParseStruct(tokens *lexer.TokenIterator) (codegen.Struct, error) {
 	// get "struct"
-	_, err := ExpectToken(tokens, lexer.STRUCT)
+	start, err := ExpectToken(tokens, lexer.STRUCT)
 
 	if err != nil {
 		return codegen.Struct{}, err
@@ -69,6 +69,8 @@ func ParseStruct(tokens *lexer.TokenIterator) (codegen.Struct, error) {
 		return codegen.Struct{}, err
 	}
 
+	structure.Span = spanFrom(tokens, start.Span)
+
 	return structure, nil
 }
 
@@ -94,5 +96,156 @@ func ParseField(tokens *lexer.TokenIterator) (codegen.Field, error) {
 		return codegen.Field{}, err
 	}
 
-	return codegen.Field{Ident: ident, Type: typ}, nil
+	return codegen.Field{Ident: ident, Type: typ, Span: spanFrom(tokens, ident.Span)}, nil
+}
+
+func ParseEnum(tokens *lexer.TokenIterator) (codegen.Enum, error) {
+	// get "enum"
+	start, err := ExpectToken(tokens, lexer.ENUM)
+
+	if err != nil {
+		return codegen.Enum{}, err
+	}
+
+	// get ident
+	path, err := ParsePath(tokens)
+
+	if err != nil {
+		return codegen.Enum{}, err
+	}
+
+	// get open brace
+	_, err = ExpectToken(tokens, lexer.CURLYOPEN)
+
+	if err != nil {
+		return codegen.Enum{}, err
+	}
+
+	enum := codegen.Enum{
+		Ident: path,
+	}
+
+	next, err := tokens.Peek()
+
+	if err != nil {
+		return codegen.Enum{}, err
+	}
+
+	// variants...
+	for next.Kind != lexer.CURLYCLOSE {
+		variant, err := ParseVariant(tokens)
+
+		if err != nil {
+			return codegen.Enum{}, err
+		}
+
+		// get comma
+		_, err = ExpectToken(tokens, lexer.COMMA)
+
+		if err != nil {
+			return codegen.Enum{}, err
+		}
+
+		enum.Variants = append(enum.Variants, variant)
+
+		next, err = tokens.Peek()
+
+		if err != nil {
+			return codegen.Enum{}, err
+		}
+	}
+
+	// get close brace
+	_, err = ExpectToken(tokens, lexer.CURLYCLOSE)
+
+	if err != nil {
+		return codegen.Enum{}, err
+	}
+
+	enum.Span = spanFrom(tokens, start.Span)
+
+	return enum, nil
+}
+
+// ParseVariant parses a variant of an enum, which may be followed by its
+// fields in parentheses, like Circle(radius: int).
+func ParseVariant(tokens *lexer.TokenIterator) (codegen.Variant, error) {
+	// get ident
+	ident, err := ParseIdent(tokens)
+
+	if err != nil {
+		return codegen.Variant{}, err
+	}
+
+	variant := codegen.Variant{Ident: ident}
+
+	next, err := tokens.Peek()
+
+	if err != nil {
+		return codegen.Variant{}, err
+	}
+
+	if next.Kind != lexer.PARENOPEN {
+		variant.Span = spanFrom(tokens, ident.Span)
+
+		return variant, nil
+	}
+
+	// get open parens
+	_, err = ExpectToken(tokens, lexer.PARENOPEN)
+
+	if err != nil {
+		return codegen.Variant{}, err
+	}
+
+	next, err = tokens.Peek()
+
+	if err != nil {
+		return codegen.Variant{}, err
+	}
+
+	// fields...
+	for next.Kind != lexer.PARENCLOSE {
+		field, err := ParseField(tokens)
+
+		if err != nil {
+			return codegen.Variant{}, err
+		}
+
+		variant.Fields = append(variant.Fields, field)
+
+		next, err = tokens.Peek()
+
+		if err != nil {
+			return codegen.Variant{}, err
+		}
+
+		if next.Kind == lexer.PARENCLOSE {
+			break
+		}
+
+		// get comma
+		_, err = ExpectToken(tokens, lexer.COMMA)
+
+		if err != nil {
+			return codegen.Variant{}, err
+		}
+
+		next, err = tokens.Peek()
+
+		if err != nil {
+			return codegen.Variant{}, err
+		}
+	}
+
+	// get close parens
+	_, err = ExpectToken(tokens, lexer.PARENCLOSE)
+
+	if err != nil {
+		return codegen.Variant{}, err
+	}
+
+	variant.Span = spanFrom(tokens, ident.Span)
+
+	return variant, nil
 }
@@ -1,16 +1,17 @@
 package parser
 
 import (
-	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/whirl-lang/whirl/pkg/codegen"
+	"github.com/whirl-lang/whirl/pkg/diagnostic"
 	"github.com/whirl-lang/whirl/pkg/lexer"
 )
 
 func ParseStructInit(tokens *lexer.TokenIterator) (codegen.StructInit, error) {
-	// get ident
-	ident, err := ParseIdent(tokens)
+	// get the name, which may be of a struct of an imported module
+	path, err := ParsePath(tokens)
 
 	if err != nil {
 		return codegen.StructInit{}, err
@@ -24,7 +25,7 @@ func ParseStructInit(tokens *lexer.TokenIterator) (codegen.StructInit, error) {
 	}
 
 	structure := codegen.StructInit{
-		Ident: ident,
+		Path: path,
 	}
 	next, err := tokens.Peek()
 
@@ -64,9 +65,46 @@ func ParseStructInit(tokens *lexer.TokenIterator) (codegen.StructInit, error) {
 		return codegen.StructInit{}, err
 	}
 
+	structure.Span = spanFrom(tokens, path.Span)
+
 	return structure, nil
 }
 
+// lookahead reports whether the next tokens are of the given kinds, without
+// consuming them.
+func lookahead(tokens *lexer.TokenIterator, kinds ...int) bool {
+	copy := *tokens
+
+	for _, kind := range kinds {
+		token, err := copy.Next()
+
+		if err != nil || token.Kind != kind {
+			return false
+		}
+	}
+
+	return true
+}
+
+// structInit reports whether a struct initializer follows, which is a path
+// and a curly brace followed by the given kinds, without consuming it.
+func structInit(tokens *lexer.TokenIterator, kinds ...int) bool {
+	copy := *tokens
+
+	if !lookahead(&copy, lexer.IDENT) {
+		return false
+	}
+
+	copy.Next()
+
+	for lookahead(&copy, lexer.COLONCOLON, lexer.IDENT) {
+		copy.Next()
+		copy.Next()
+	}
+
+	return lookahead(&copy, append([]int{lexer.CURLYOPEN}, kinds...)...)
+}
+
 func ParseInitField(tokens *lexer.TokenIterator) (codegen.FieldInit, error) {
 	// get ident
 	ident, err := ParseIdent(tokens)
@@ -89,11 +127,11 @@ func ParseInitField(tokens *lexer.TokenIterator) (codegen.FieldInit, error) {
 		return codegen.FieldInit{}, err
 	}
 
-	return codegen.FieldInit{Ident: ident, Expr: expr}, nil
+	return codegen.FieldInit{Ident: ident, Expr: expr, Span: spanFrom(tokens, ident.Span)}, nil
 }
 
 func ParseArray(tokens *lexer.TokenIterator) (codegen.Array, error) {
-	_, err := ExpectToken(tokens, lexer.BRACKETOPEN)
+	start, err := ExpectToken(tokens, lexer.BRACKETOPEN)
 
 	if err != nil {
 		return codegen.Array{}, err
@@ -147,89 +185,467 @@ func ParseArray(tokens *lexer.TokenIterator) (codegen.Array, error) {
 		return codegen.Array{}, err
 	}
 
-	return codegen.Array{Value: elements}, nil
+	return codegen.Array{Value: elements, Span: spanFrom(tokens, start.Span)}, nil
 }
 
+// ParseMap parses a map literal like {"a": 1, "b": 2}. The keys can't be
+// ranges without parentheses, as the colon ends them.
+func ParseMap(tokens *lexer.TokenIterator) (codegen.Map, error) {
+	start, err := ExpectToken(tokens, lexer.CURLYOPEN)
+
+	if err != nil {
+		return codegen.Map{}, err
+	}
+
+	var m codegen.Map
+
+	for !lookahead(tokens, lexer.CURLYCLOSE) {
+		key, err := ParseBinary(tokens, 1)
+
+		if err != nil {
+			return codegen.Map{}, err
+		}
+
+		_, err = ExpectToken(tokens, lexer.COLON)
+
+		if err != nil {
+			return codegen.Map{}, err
+		}
+
+		value, err := ParseExpr(tokens)
+
+		if err != nil {
+			return codegen.Map{}, err
+		}
+
+		m.Keys = append(m.Keys, key)
+		m.Values = append(m.Values, value)
+
+		// the comma after the last entry is optional
+		if !lookahead(tokens, lexer.COMMA) {
+			break
+		}
+
+		_, err = ExpectToken(tokens, lexer.COMMA)
+
+		if err != nil {
+			return codegen.Map{}, err
+		}
+	}
+
+	_, err = ExpectToken(tokens, lexer.CURLYCLOSE)
+
+	if err != nil {
+		return codegen.Map{}, err
+	}
+
+	m.Span = spanFrom(tokens, start.Span)
+
+	return m, nil
+}
+
+// binding power of the binary operators, higher binds tighter
+var precedence = map[int]int{
+	lexer.OR:    1,
+	lexer.AND:   2,
+	lexer.EQ:    3,
+	lexer.NE:    3,
+	lexer.LT:    4,
+	lexer.GT:    4,
+	lexer.LE:    4,
+	lexer.GE:    4,
+	lexer.PLUS:  5,
+	lexer.MINUS: 5,
+	lexer.MUL:   6,
+	lexer.DIV:   6,
+	lexer.MOD:   6,
+}
+
+// ParseExpr parses an expression, which may be a range lower:upper or
+// lower..=upper, optionally followed by step and the step.
 func ParseExpr(tokens *lexer.TokenIterator) (codegen.Expr, error) {
+	start, err := tokens.Peek()
+
+	if err != nil {
+		return nil, err
+	}
+
+	lower, err := ParseBinary(tokens, 1)
+
+	if err != nil {
+		return nil, err
+	}
+
 	next, err := tokens.Peek()
 
+	if err != nil || (next.Kind != lexer.COLON && next.Kind != lexer.DOTDOTEQ) {
+		return lower, err
+	}
+
+	_, err = tokens.Next()
+
 	if err != nil {
-		return codegen.ExprMath{}, err
+		return nil, err
 	}
 
-	if next.Kind == lexer.BRACKETOPEN {
-		return ParseArray(tokens)
+	upper, err := ParseBinary(tokens, 1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r := codegen.Range{Lower: lower, Upper: upper, Inclusive: next.Kind == lexer.DOTDOTEQ}
+	next, err = tokens.Peek()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// step is only a keyword after a range, so it can still name variables
+	if next.Kind == lexer.IDENT && next.Value == "step" {
+		_, err = tokens.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		r.Step, err = ParseBinary(tokens, 1)
+
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	counter := 0
-	expr := codegen.ExprMath{}
+	r.Span = spanFrom(tokens, start.Span)
+
+	return r, nil
+}
+
+// ParseBinary parses a chain of binary operations whose operators bind at
+// least as tight as minPrecedence.
+func ParseBinary(tokens *lexer.TokenIterator, minPrecedence int) (codegen.Expr, error) {
+	start, err := tokens.Peek()
+
+	if err != nil {
+		return nil, err
+	}
+
+	left, err := ParseCast(tokens)
+
+	if err != nil {
+		return nil, err
+	}
 
 	for {
-		if next.Kind == lexer.PARENOPEN {
-			counter++
+		next, err := tokens.Peek()
+
+		if err != nil {
+			return nil, err
 		}
 
-		if next.Kind == lexer.PARENCLOSE {
-			counter--
+		prec, ok := precedence[next.Kind]
+
+		if !ok || prec < minPrecedence {
+			return left, nil
 		}
 
-		if next.IsSeparator() && counter == 0 && next.Kind != lexer.PARENCLOSE {
-			break
+		// get operator
+		_, err = tokens.Next()
+
+		if err != nil {
+			return nil, err
 		}
 
-		if counter < 0 {
-			return expr, fmt.Errorf("unexpected token %s", lexer.TokensPretty[next.Kind])
+		// operators are left associative, so the right side binds tighter
+		right, err := ParseBinary(tokens, prec+1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = codegen.Binary{Op: next.Kind, Left: left, Right: right, Span: spanFrom(tokens, start.Span)}
+	}
+}
+
+// ParseCast parses a unary expression followed by any number of casts, like
+// -x as u8, which binds tighter than the binary operators.
+func ParseCast(tokens *lexer.TokenIterator) (codegen.Expr, error) {
+	start, err := tokens.Peek()
+
+	if err != nil {
+		return nil, err
+	}
+
+	expr, err := ParseUnary(tokens)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for lookahead(tokens, lexer.AS) {
+		_, err = ExpectToken(tokens, lexer.AS)
+
+		if err != nil {
+			return nil, err
 		}
 
-		token, err := tokens.Next()
+		typ, err := ParseType(tokens)
 
 		if err != nil {
-			return expr, err
+			return nil, err
 		}
 
-		expr.Tokens = append(expr.Tokens, codegen.ExprToken{Token: token})
+		expr = codegen.Cast{Expr: expr, Type: typ, Span: spanFrom(tokens, start.Span)}
+	}
 
-		// check for array access
-		next, err = tokens.Peek()
+	return expr, nil
+}
+
+func ParseUnary(tokens *lexer.TokenIterator) (codegen.Expr, error) {
+	next, err := tokens.Peek()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if next.Kind != lexer.NOT && next.Kind != lexer.MINUS && next.Kind != lexer.REF && next.Kind != lexer.MUL {
+		return ParsePostfix(tokens)
+	}
+
+	// get operator
+	_, err = tokens.Next()
+
+	if err != nil {
+		return nil, err
+	}
+
+	mutable := next.Kind == lexer.REF && lookahead(tokens, lexer.MUT)
+
+	if mutable {
+		_, err = ExpectToken(tokens, lexer.MUT)
 
 		if err != nil {
-			return expr, err
+			return nil, err
 		}
+	}
 
-		if next.Kind == lexer.BRACKETOPEN {
-			open, err := ExpectToken(tokens, lexer.BRACKETOPEN)
+	expr, err := ParseUnary(tokens)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch next.Kind {
+	case lexer.REF:
+		return codegen.AddressOf{Expr: expr, Mutable: mutable, Span: spanFrom(tokens, next.Span)}, nil
+	case lexer.MUL:
+		return codegen.Deref{Expr: expr, Span: spanFrom(tokens, next.Span)}, nil
+	}
+
+	return codegen.Unary{Op: next.Kind, Expr: expr, Span: spanFrom(tokens, next.Span)}, nil
+}
+
+// ParsePostfix parses a primary expression followed by any number of calls,
+// indexes and field accesses.
+func ParsePostfix(tokens *lexer.TokenIterator) (codegen.Expr, error) {
+	start, err := tokens.Peek()
+
+	if err != nil {
+		return nil, err
+	}
+
+	expr, err := ParsePrimary(tokens)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		next, err := tokens.Peek()
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch next.Kind {
+		case lexer.PARENOPEN:
+			args, err := ParseCallArgs(tokens)
+
+			if err != nil {
+				return nil, err
+			}
+
+			expr = codegen.Call{Callee: expr, Args: args, Span: spanFrom(tokens, start.Span)}
+		case lexer.BRACKETOPEN:
+			_, err = ExpectToken(tokens, lexer.BRACKETOPEN)
 
 			if err != nil {
-				return expr, err
+				return nil, err
 			}
 
 			index, err := ParseExpr(tokens)
 
 			if err != nil {
-				return expr, err
+				return nil, err
 			}
 
-			close, err := ExpectToken(tokens, lexer.BRACKETCLOSE)
+			_, err = ExpectToken(tokens, lexer.BRACKETCLOSE)
 
 			if err != nil {
-				return expr, err
+				return nil, err
 			}
 
-			expr.Tokens = append(expr.Tokens, codegen.ExprToken{Token: open}, index, codegen.ExprToken{Token: close})
+			expr = codegen.Index{Expr: expr, Index: index, Span: spanFrom(tokens, start.Span)}
+		case lexer.PERIOD:
+			_, err = ExpectToken(tokens, lexer.PERIOD)
+
+			if err != nil {
+				return nil, err
+			}
+
+			field, err := ParseIdent(tokens)
+
+			if err != nil {
+				return nil, err
+			}
+
+			expr = codegen.FieldAccess{Expr: expr, Field: field, Span: spanFrom(tokens, start.Span)}
+		default:
+			return expr, nil
+		}
+	}
+}
+
+func ParsePrimary(tokens *lexer.TokenIterator) (codegen.Expr, error) {
+	next, err := tokens.Peek()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var value codegen.Value
+
+	switch next.Kind {
+	case lexer.INT_LIT:
+		value, err = ParseInt(tokens)
+	case lexer.FLOAT_LIT:
+		value, err = ParseFloat(tokens)
+	case lexer.STRING_LIT:
+		value, err = ParseString(tokens)
+	case lexer.BOOLEAN_LIT:
+		value, err = ParseBool(tokens)
+	case lexer.CHAR_LIT:
+		value, err = ParseChar(tokens)
+	case lexer.BRACKETOPEN:
+		return ParseArray(tokens)
+	case lexer.CURLYOPEN:
+		return ParseMap(tokens)
+	case lexer.PARENOPEN:
+		return ParseParens(tokens)
+	case lexer.MATCH:
+		return ParseMatch(tokens)
+	case lexer.IDENT:
+		// an empty initializer can't be told apart from an identifier
+		// followed by a block, like in "if done {}"
+		if structInit(tokens, lexer.IDENT, lexer.COLON) {
+			return ParseStructInit(tokens)
+		}
+
+		path, err := ParsePath(tokens)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// a single identifier is a variable or a procedure of this module
+		if len(path.Tokens) == 1 {
+			return path.Tokens[0], nil
 		}
 
+		return path, nil
+	default:
+		return nil, diagnostic.Errorf(next.Span, "expected an expression, got %s", lexer.TokensPretty[next.Kind])
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return codegen.Literal{Value: value, Span: next.Span}, nil
+}
+
+func ParseParens(tokens *lexer.TokenIterator) (codegen.Expr, error) {
+	// get open parens
+	_, err := ExpectToken(tokens, lexer.PARENOPEN)
+
+	if err != nil {
+		return nil, err
+	}
+
+	expr, err := ParseExpr(tokens)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// get close parens
+	_, err = ExpectToken(tokens, lexer.PARENCLOSE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return expr, nil
+}
+
+// ParseCallArgs parses a parenthesized, comma separated list of arguments.
+func ParseCallArgs(tokens *lexer.TokenIterator) ([]codegen.Expr, error) {
+	// get open parens
+	_, err := ExpectToken(tokens, lexer.PARENOPEN)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// get args
+	next, err := tokens.Peek()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var args []codegen.Expr
+
+	for next.Kind != lexer.PARENCLOSE {
+		arg, err := ParseExpr(tokens)
+
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, arg)
+
 		next, err = tokens.Peek()
 
 		if err != nil {
-			return expr, err
+			return nil, err
 		}
 
-		if next.Kind == lexer.PARENCLOSE && counter == 0 {
+		_, err = ExpectToken(tokens, lexer.COMMA)
+
+		if err != nil {
 			break
 		}
 	}
 
-	return expr, nil
+	// get close parens
+	_, err = ExpectToken(tokens, lexer.PARENCLOSE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return args, nil
 }
 
 func ParseInt(tokens *lexer.TokenIterator) (codegen.Int, error) {
@@ -239,13 +655,41 @@ func ParseInt(tokens *lexer.TokenIterator) (codegen.Int, error) {
 		return codegen.Int{}, err
 	}
 
-	value, err := strconv.ParseInt(token.Value, 10, 64)
+	digits, base := token.Value, 10
+
+	// the lexer checked the digits
+	switch {
+	case strings.HasPrefix(digits, "0x"):
+		digits, base = digits[2:], 16
+	case strings.HasPrefix(digits, "0o"):
+		digits, base = digits[2:], 8
+	case strings.HasPrefix(digits, "0b"):
+		digits, base = digits[2:], 2
+	}
+
+	value, err := strconv.ParseUint(digits, base, 64)
 
 	if err != nil {
-		return codegen.Int{}, err
+		return codegen.Int{}, diagnostic.Errorf(token.Span, "%s is too large for an integer", token.Value)
+	}
+
+	return codegen.Int{Value: value, Span: token.Span}, nil
+}
+
+func ParseFloat(tokens *lexer.TokenIterator) (codegen.Float, error) {
+	token, err := ExpectToken(tokens, lexer.FLOAT_LIT)
+
+	if err != nil {
+		return codegen.Float{}, err
+	}
+
+	value, err := strconv.ParseFloat(token.Value, 64)
+
+	if err != nil {
+		return codegen.Float{}, diagnostic.Errorf(token.Span, "%s is too large for a float", token.Value)
 	}
 
-	return codegen.Int{Value: value}, nil
+	return codegen.Float{Value: value, Span: token.Span}, nil
 }
 
 func ParseString(tokens *lexer.TokenIterator) (codegen.String, error) {
@@ -255,7 +699,8 @@ func ParseString(tokens *lexer.TokenIterator) (codegen.String, error) {
 		return codegen.String{}, err
 	}
 
-	return codegen.String{Value: token.Value}, nil
+	// strip the quotes
+	return codegen.String{Value: token.Value[1 : len(token.Value)-1], Span: token.Span}, nil
 }
 
 func ParseBool(tokens *lexer.TokenIterator) (codegen.Bool, error) {
@@ -265,17 +710,17 @@ func ParseBool(tokens *lexer.TokenIterator) (codegen.Bool, error) {
 		return codegen.Bool{}, err
 	}
 
-	return codegen.Bool{Value: token.Value == "true"}, nil
+	return codegen.Bool{Value: token.Value == "1", Span: token.Span}, nil
 }
 
 func ParseVoid(tokens *lexer.TokenIterator) (codegen.Void, error) {
-	_, err := ExpectToken(tokens, lexer.VOID)
+	token, err := ExpectToken(tokens, lexer.VOID)
 
 	if err != nil {
 		return codegen.Void{}, err
 	}
 
-	return codegen.Void{}, nil
+	return codegen.Void{Span: token.Span}, nil
 }
 
 func ParseChar(tokens *lexer.TokenIterator) (codegen.Char, error) {
@@ -285,5 +730,5 @@ func ParseChar(tokens *lexer.TokenIterator) (codegen.Char, error) {
 		return codegen.Char{}, err
 	}
 
-	return codegen.Char{Value: rune(token.Value[0])}, nil
+	return codegen.Char{Value: rune(token.Value[0]), Span: token.Span}, nil
 }
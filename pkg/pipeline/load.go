@@ -0,0 +1,91 @@
+package pipeline
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/whirl-lang/whirl/pkg/codegen"
+	"github.com/whirl-lang/whirl/pkg/diagnostic"
+	"github.com/whirl-lang/whirl/pkg/lexer"
+	"github.com/whirl-lang/whirl/pkg/parser"
+)
+
+type loader struct {
+	diags   *diagnostic.Collector
+	modules map[string]*codegen.Module
+	loading map[string]bool
+}
+
+// Load parses file and every file it imports, directly or indirectly. Each
+// file is parsed once, so a module imported from several places is shared.
+func Load(file string, content []byte, diags *diagnostic.Collector) *codegen.Module {
+	l := loader{
+		diags:   diags,
+		modules: map[string]*codegen.Module{},
+		loading: map[string]bool{},
+	}
+
+	return l.load(file, content, "")
+}
+
+func (l *loader) load(file string, content []byte, namespace string) *codegen.Module {
+	l.diags.AddSource(file, content)
+
+	module := &codegen.Module{
+		Name:      strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)),
+		Path:      file,
+		Namespace: namespace,
+		Imports:   map[string]*codegen.Module{},
+	}
+
+	l.modules[file] = module
+	l.loading[file] = true
+
+	tokens := lexer.Iterator(content)
+	tokens.File = file
+	instructions := parser.Parse(tokens, l.diags)
+
+	for i, instruction := range instructions {
+		if imp, ok := instruction.(codegen.Import); ok {
+			imp.Module = l.resolve(module, imp)
+			instructions[i] = imp
+		}
+	}
+
+	module.Instructions = instructions
+	delete(l.loading, file)
+
+	return module
+}
+
+// resolve loads the module an import refers to. Paths are relative to the
+// importing file.
+func (l *loader) resolve(from *codegen.Module, imp codegen.Import) *codegen.Module {
+	file := filepath.Join(filepath.Dir(from.Path), imp.Path)
+
+	if l.loading[file] {
+		l.diags.Report(diagnostic.Errorf(imp.Span, "import cycle: \"%s\" is already being imported", imp.Path))
+
+		return nil
+	}
+
+	module, ok := l.modules[file]
+
+	if !ok {
+		content, err := os.ReadFile(file)
+
+		if err != nil {
+			l.diags.Report(diagnostic.Errorf(imp.Span, "cannot import \"%s\": %v", imp.Path, errors.Unwrap(err)))
+
+			return nil
+		}
+
+		module = l.load(file, content, codegen.PathToNamespace(file))
+	}
+
+	from.Imports[module.Name] = module
+
+	return module
+}
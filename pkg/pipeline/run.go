@@ -3,37 +3,39 @@ package pipeline
 import (
 	"io"
 
+	"github.com/whirl-lang/whirl/pkg/check"
 	"github.com/whirl-lang/whirl/pkg/codegen"
-	"github.com/whirl-lang/whirl/pkg/lexer"
-	"github.com/whirl-lang/whirl/pkg/parser"
+	"github.com/whirl-lang/whirl/pkg/diagnostic"
 )
 
-func transpile(content []byte) parser.InstructionIterator {
-	tokens := lexer.Iterator(content)
-	nodes := parser.Iterator(tokens)
+// Check loads the given file along with everything it imports and checks it.
+// Problems are reported into diags; the module is only complete when diags
+// has no errors afterwards.
+func Check(content []byte, file string, diags *diagnostic.Collector) *codegen.Module {
+	module := Load(file, content, diags)
 
-	return nodes
-}
+	if diags.HasErrors() {
+		return module
+	}
 
-// Transpiles the given Whirl source code into C source code.
-func transpileC(content []byte, path string, out io.Writer) {
-	nodes := transpile(content)
+	check.Check(module, diags)
 
-	codegen.WriteC(codegen.Context{
-		Namespace: codegen.PathToNamespace(path),
-		Path:      path,
-		Transpile: TranspileC,
-	}, &nodes, out)
+	return module
 }
 
-func TranspileC(content []byte, path string, out io.Writer) {
-	nodes := transpile(content)
+// Transpiles the Whirl source code of the given file, along with everything
+// it imports, into C source code. Problems are reported into diags; the
+// output is only usable when diags has no errors afterwards.
+func TranspileC(content []byte, file string, out io.Writer, diags *diagnostic.Collector) {
+	module := Check(content, file, diags)
+
+	if diags.HasErrors() {
+		return
+	}
 
-	out.Write([]byte("#include <stdio.h>\n\n"))
+	err := codegen.WriteModule(codegen.Context{Diagnostics: diags}, module, out)
 
-	codegen.WriteC(codegen.Context{
-		Namespace: "",
-		Path:      path,
-		Transpile: transpileC,
-	}, &nodes, out)
+	if err != nil {
+		diags.ReportError(err)
+	}
 }
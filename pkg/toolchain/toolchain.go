@@ -0,0 +1,117 @@
+package toolchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Known are the C compilers that are looked for, in order of preference. tcc
+// comes first because it compiles the fastest.
+var Known = []string{"tcc", "gcc", "clang", "cc"}
+
+// Env is the environment variable that selects the C compiler when none is
+// given on the command line.
+const Env = "WHIRL_CC"
+
+// Compiler is a C compiler that the generated code is built with.
+type Compiler struct {
+	// Name is how the compiler was asked for, e.g. gcc or /usr/bin/clang-16.
+	Name string
+	// Path is the executable that is run.
+	Path string
+}
+
+// Options are the flags the C code is compiled with.
+type Options struct {
+	// Optimize is the optimization level, passed as -O<level>. Empty leaves
+	// the compiler's default.
+	Optimize string
+	// Debug adds debug information.
+	Debug bool
+	// Warnings shows the C compiler's warnings, which are hidden by default
+	// because the generated code is not meant to be read.
+	Warnings bool
+}
+
+// Find returns the C compiler with the given name or path. If name is empty
+// the one in WHIRL_CC is used, and if that is empty too the first known
+// compiler that is installed.
+func Find(name string) (Compiler, error) {
+	if name == "" {
+		name = os.Getenv(Env)
+	}
+
+	if name != "" {
+		path, err := exec.LookPath(name)
+
+		if err != nil {
+			return Compiler{}, fmt.Errorf("C compiler %s not found", name)
+		}
+
+		return Compiler{Name: name, Path: path}, nil
+	}
+
+	for _, name := range Known {
+		if path, err := exec.LookPath(name); err == nil {
+			return Compiler{Name: name, Path: path}, nil
+		}
+	}
+
+	return Compiler{}, fmt.Errorf("no C compiler found, install one of %s or set %s", strings.Join(Known, ", "), Env)
+}
+
+// Args returns the arguments that compile source into the executable output.
+func (c Compiler) Args(source string, output string, options Options) []string {
+	var args []string
+
+	if options.Optimize != "" {
+		args = append(args, "-O"+options.Optimize)
+	}
+
+	if options.Debug {
+		args = append(args, "-g")
+	}
+
+	if options.Warnings {
+		args = append(args, "-Wall")
+	} else {
+		args = append(args, "-w")
+	}
+
+	return append(args, "-o", output, source)
+}
+
+// Error is returned when the C compiler fails.
+type Error struct {
+	Compiler Compiler
+	Status   int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s exited with status %d", filepath.Base(e.Compiler.Name), e.Status)
+}
+
+// Build compiles source into the executable output. It returns what the
+// compiler printed, which are its errors and warnings.
+func (c Compiler) Build(source string, output string, options Options) (string, error) {
+	cmd := exec.Command(c.Path, c.Args(source, output, options)...)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	err := cmd.Run()
+
+	var exit *exec.ExitError
+
+	if errors.As(err, &exit) {
+		return out.String(), &Error{Compiler: c, Status: exit.ExitCode()}
+	}
+
+	return out.String(), err
+}
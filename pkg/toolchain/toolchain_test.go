@@ -0,0 +1,41 @@
+package toolchain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToolchainArgs(t *testing.T) {
+	compiler := Compiler{Name: "gcc", Path: "/usr/bin/gcc"}
+
+	args := strings.Join(compiler.Args("out.c", "out", Options{Optimize: "2", Debug: true}), " ")
+
+	if args != "-O2 -g -w -o out out.c" {
+		t.Fatalf("unexpected arguments %q", args)
+	}
+
+	args = strings.Join(compiler.Args("out.c", "out", Options{Warnings: true}), " ")
+
+	if args != "-Wall -o out out.c" {
+		t.Fatalf("unexpected arguments %q", args)
+	}
+}
+
+func TestToolchainFind(t *testing.T) {
+	t.Setenv(Env, "whirl-no-such-compiler")
+
+	_, err := Find("")
+
+	if err == nil || !strings.Contains(err.Error(), "whirl-no-such-compiler") {
+		t.Fatalf("expected the compiler from %s to be missing, got %v", Env, err)
+	}
+
+	t.Setenv("PATH", "")
+	t.Setenv(Env, "")
+
+	_, err = Find("")
+
+	if err == nil || !strings.Contains(err.Error(), "no C compiler found") {
+		t.Fatalf("expected no compiler to be found, got %v", err)
+	}
+}